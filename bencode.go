@@ -28,8 +28,8 @@
 // Bencode format (https://en.wikipedia.org/wiki/Bencode).
 //
 // Decoding:
-//   byte string -> string
-//   integer -> int64
+//   byte string -> string ([]byte with Decoder.UseBytes())
+//   integer -> int64 (uint64 if too large for an int64)
 //   list -> []interface{}
 //   dictionary -> map[string]interface{}
 //
@@ -37,9 +37,18 @@
 //   string -> byte string
 //   int, int16, int32, int64 -> integer
 //   float32, float64 -> byte string
-//   any slice -> list
+//   []byte, [N]byte -> byte string
+//   any other slice -> list
 //   map -> dictionary
 //   struct -> dictionary
+//   time.Time -> integer (seconds since the Unix epoch, by default)
+//   bool -> integer (1 for true, 0 for false)
+//   *big.Int -> integer
+//
+// Bencode has no boolean type, so encoding bools as integers is only a
+// convention, albeit a common one. FillData() correspondingly fills a bool
+// from an integer, treating any nonzero value as true, or from the string
+// "true" or "false". See BoolFormat for using strings instead.
 //
 // Examples:
 //
@@ -94,26 +103,100 @@ package bencode
 import (
     "bufio"
     "bytes"
+    "errors"
     "fmt"
     "io"
-    "os"
+    "math"
+    "math/big"
     "reflect"
     "sort"
     "strconv"
     "strings"
+    "sync"
+    "time"
 )
 
 const Version = "0.9.2"
 
+// Returned when attempting to encode a nil pointer or interface.
+var ErrEncodeNil = errors.New("cannot encode a nil value")
+
+// Returned by DecodeNonEmpty() for input with no value. It wraps io.EOF.
+var ErrEmptyInput = fmt.Errorf("no value in empty input: %w", io.EOF)
+
+// The default maximum nesting depth of lists and dictionaries allowed by a
+// Decoder.
+const DefaultMaxDepth = 100
+
 // Decoder object
 type Decoder struct {
     // r *bufio.Reader
     r *breader
+    disallow_trailing bool
+    coercer coercer
+    max_depth int
+    depth int
+    max_depth_seen int
+    max_string_len int64
+    max_input_bytes int64
+    preserve_raw bool
+    require_sorted bool
+    disallow_dups bool
+    use_number bool
+    // strip leading zeros from Numbers rather than rejecting them, as
+    // Canonicalize() does
+    trim_number_zeros bool
+    use_bytes bool
+    value_hook func(path []string, v interface{}) (interface{}, error)
+    // reader returned by StringReader(), if any
+    str_reader *string_reader
+    // token read by Peek(), if any, to be returned by the next Token()
+    peeked *peeked_token
+    // path to the value being decoded, tracked only when value_hook is set
+    path []string
+    // byte spans of decoded dictionaries, relative to dict_base, tracked
+    // while filling RawDict values
+    dict_spans map[uintptr][2]uint64
+    dict_base uint64
+    // dictionary keys whose values are discarded rather than decoded
+    skip_keys map[string]bool
+    // table of short strings to share, if InternStrings() has been called
+    interned map[string]string
+    intern_buf []byte
 }
 
 // Encoder object
 type Encoder struct {
     w io.Writer
+    redacted map[string]bool
+    redact_placeholder string
+    key_hook func(path []string, key string)
+    time_unit time.Duration
+    bool_format BoolFormat
+    // path to the value being encoded, tracked only when key_hook is set
+    path []string
+    // minimum length of byte strings to count, or 0 to not count them
+    dup_min_len int
+    string_counts map[string]int
+    // keys from a DictIterator are already in canonical order
+    presorted_keys bool
+    // sort the keys of Pairs instead of keeping their order
+    sort_pairs bool
+    // maps field names without a tag name to dictionary keys
+    key_mapper func(string) string
+    // reused for formatting integers and string lengths
+    scratch []byte
+    // containers opened with StartDict() and StartList(), innermost last
+    stream []*stream_frame
+    // buffer streamed dictionaries to sort their keys
+    sort_stream bool
+    // treat every struct field as tagged omitempty
+    omit_empty bool
+    // wraps the Writer given, unless it is already buffered, and is flushed
+    // after each top-level value
+    buf *bufio.Writer
+    // the Writer given, beneath buf, counting the bytes that reach it
+    sink *counting_writer
 }
 
 // A Delim is a byte representing the start or end of a list or dictionary:
@@ -122,6 +205,19 @@ type Encoder struct {
 // You only need to worry about this if you want to handle decoding yourself.
 type Delim byte
 
+// A RawScalar holds a decoded integer or byte string along with the exact
+// bytes it was decoded from. The Encoder writes a RawScalar as its Raw bytes,
+// so documents decoded with Decoder.PreserveRaw() can be re-encoded
+// byte-for-byte, even when they contain non-canonical values like "i007e".
+type RawScalar struct {
+    // The decoded value, an int64 or a string (or another type returned by
+    // Token(), depending on the Decoder's options).
+    Value Token
+
+    // The original encoding of the value.
+    Raw []byte
+}
+
 // A Token holds a value of one of these types:
 //
 //     Delim, representing the beginning lists and dictionaries: l d
@@ -132,17 +228,81 @@ type Delim byte
 // You only need to worry about this if you want to handle decoding yourself.
 type Token interface{}
 
-// func Unmarshal(data []byte, v interface {}) error {
+// Decode the Bencode data, data, and store the result in the value pointed to
+// by v, coercing it as FillData() does.
+func Unmarshal(data []byte, v interface{}) error {
+    dec := NewDecoder(bytes.NewReader(data))
+    return dec.DecodeInto(v)
+}
+
+// Decode the Bencode data, data, into a new value of type T, e.g.,
+//
+//     info, err := bencode.UnmarshalTyped[TorrentInfo](data)
+func UnmarshalTyped[T any](data []byte) (T, error) {
+    var v T
+    err := Unmarshal(data, &v)
 
-// }
+    return v, err
+}
 
 type breader struct {
     r *bufio.Reader
     pos uint64
+    // buffers recording the bytes read, innermost last
+    recs []*bytes.Buffer
+    // position at which reads start failing, if max_read is set
+    limit uint64
+    max_read int64
 }
 
 // Utility function to coerce the input to the output structure.
+//
+// Struct fields are matched to dictionary keys by name, or by the name given
+// in a `bencode` struct tag. A tag name of "-" causes the field to be
+// ignored. As with encoding/json, the fields of an embedded struct are
+// promoted into the enclosing dictionary unless the embedded field is given
+// a tag name. The tag may also carry size limits that are enforced before the
+// value is coerced, e.g.,
+//
+//     Name string   `bencode:"name,maxlen=255"`
+//     Tags []string `bencode:"tags,maxitems=16"`
+//
+// A map field tagged with the "extra" option receives the dictionary keys
+// that match no other field, and its entries are written back out when the
+// struct is encoded, so unrecognized keys survive a round trip, e.g.,
+//
+//     Extra map[string]interface{} `bencode:",extra"`
+//
+// A []byte field, e.g., a json.RawMessage, tagged with the "json" option
+// receives its value converted to JSON by ToJSON(), and is converted back by
+// FromJSON() when the struct is encoded, e.g.,
+//
+//     Info json.RawMessage `bencode:"info,json"`
+//
+// Dictionaries may also fill typed maps with string keys, e.g.,
+// map[string]int64, with each value coerced to the map's element type.
 func FillData(out_intfc interface{}, in_intfc interface{}) error {
+    return new(coercer).fill_data(out_intfc, in_intfc)
+}
+
+// Options for coercing decoded data into Go values.
+type coercer struct {
+    // parse byte strings holding integers into integer map values
+    string_ints bool
+    time_unit time.Duration
+    bool_format BoolFormat
+    strict_bools bool
+    // fall back to matching struct fields to keys case-insensitively
+    fold_keys bool
+    // return an error for dictionary keys that match no struct field
+    disallow_unknown bool
+    // maps field names without a tag name to dictionary keys
+    key_mapper func(string) string
+    // encodings of decoded dictionaries, keyed by map pointer
+    raw_dicts map[uintptr][]byte
+}
+
+func (c *coercer) fill_data(out_intfc interface{}, in_intfc interface{}) error {
     out := reflect.ValueOf(out_intfc)
     in := reflect.ValueOf(in_intfc)
 
@@ -163,46 +323,301 @@ func FillData(out_intfc interface{}, in_intfc interface{}) error {
         k = out.Kind()
     }
 
-    return set_val_coerce(&out, in)
+    return c.set_val_coerce(&out, in)
 }
 
-func unmarshal_struct(out *reflect.Value, in reflect.Value) (error) {
+func (c *coercer) unmarshal_struct(out *reflect.Value, in reflect.Value) (error) {
     d, ok := in.Interface().(map[string]interface{})
     if !ok {
-        return fmt.Errorf("FillData not passed map[string]interface{}")
+        return coerce_error(in.Type(), out.Type(),
+            "FillData not passed map[string]interface{}")
+    }
+
+    fields := struct_fields(out.Type(), c.key_mapper)
+
+    var field_names map[string]bool
+    if c.fold_keys {
+        field_names = make(map[string]bool, len(fields))
+        for _, f := range fields {
+            field_names[f.tag.name] = true
+        }
+    }
+
+    var extra *struct_field
+    for _, f := range fields {
+        if f.tag.has("extra") {
+            extra = f
+        }
     }
 
-    t := out.Type()
+    var used map[string]bool
+    if c.disallow_unknown || extra != nil {
+        used = make(map[string]bool, len(d))
+    }
 
-    for i := 0; i < t.NumField(); i++ {
-        f := t.Field(i)
-        tag_val := f.Tag.Get("bencode")
-        flag_list := strings.Split(tag_val, ",")
-        name := flag_list[0]
-        if name == "" {
-            name = f.Name
+    for _, f := range fields {
+        tag := f.tag
+        if f == extra {
+            continue
         }
+        name := tag.name
 
         d_data, ok := d[name]
+        if !ok && c.fold_keys {
+            name, ok = fold_key_match(d, name, field_names)
+            d_data = d[name]
+        }
+        if ok && used != nil {
+            used[name] = true
+        }
         if ok {
-            f_val := out.Field(i)
+            f_val := field_by_index_alloc(*out, f.index)
             d_val := reflect.ValueOf(d_data)
             // fk := f_val.Kind()
             // d_k := d_val.Kind()
             // fmt.Fprintf(os.Stderr, "setting field %s (%s), input is a %s\n", name, fk, d_k)
             // f_val.Set(reflect.ValueOf(d_data))
 
-            err := set_val_coerce(&f_val, d_val)
+            if err := check_field_limits(tag, &f_val, d_val); err != nil {
+                return wrap_coerce_path(name, err)
+            }
+
+            if tag.has("json") {
+                if err := set_json_field(&f_val, d_data); err != nil {
+                    return wrap_coerce_path(name, err)
+                }
+                continue
+            }
+
+            fc := c
+            if unit, ok := tag.time_unit(); ok {
+                field_c := *c
+                field_c.time_unit = unit
+                fc = &field_c
+            }
+
+            err := fc.set_val_coerce(&f_val, d_val)
             if err != nil {
-                return err
+                return wrap_coerce_path(name, err)
+            }
+        }
+    }
+
+    if extra != nil && len(used) < len(d) {
+        leftover := make(map[string]interface{}, len(d) - len(used))
+        for k, v := range d {
+            if !used[k] {
+                leftover[k] = v
+            }
+        }
+
+        f_val := field_by_index_alloc(*out, extra.index)
+        if err := c.set_val_coerce(&f_val, reflect.ValueOf(leftover));
+            err != nil {
+            return wrap_coerce_path(extra.tag.name, err)
+        }
+
+        return nil
+    }
+
+    if used != nil && len(used) < len(d) {
+        unknown := make([]string, 0, len(d) - len(used))
+        for k := range d {
+            if !used[k] {
+                unknown = append(unknown, k)
             }
         }
+        sort.Strings(unknown)
+
+        return coerce_error(in.Type(), out.Type(), "unknown keys %q for %s",
+            unknown, out.Type())
+    }
+
+    return nil
+}
+
+// Return the key in d that matches name case-insensitively, ignoring keys that
+// exactly match the name of some field. If there are several, the first in
+// sorted order is used.
+func fold_key_match(d map[string]interface{}, name string,
+    field_names map[string]bool) (string, bool) {
+
+    match := ""
+    found := false
+    for k := range d {
+        if field_names[k] || !strings.EqualFold(k, name) {
+            continue
+        }
+        if !found || k < match {
+            match = k
+            found = true
+        }
+    }
+
+    return match, found
+}
+
+// An error coercing a value, qualified by the path to the value within the
+// input, e.g., "files[1].path[0]".
+type coerce_path_error struct {
+    path string
+    err error
+}
+
+func (e *coerce_path_error) Error() string {
+    return fmt.Sprintf("couldn't coerce %s: %s", e.path, e.err)
+}
+
+func (e *coerce_path_error) Unwrap() error {
+    return e.err
+}
+
+// Prefix the path in err with the given path segment: a dictionary key or a
+// list index such as "[1]".
+func wrap_coerce_path(segment string, err error) error {
+    pe, ok := err.(*coerce_path_error)
+    if !ok {
+        return &coerce_path_error{path: segment, err: err}
+    }
+
+    return &coerce_path_error{path: join_path(segment, pe.path), err: pe.err}
+}
+
+// Prefix path with segment, separating dictionary keys with dots.
+func join_path(segment, path string) string {
+    if strings.HasPrefix(path, "[") {
+        return segment + path
+    }
+
+    return segment + "." + path
+}
+
+// An error encoding a value nested in the one passed to Encode(), with the
+// path to it, e.g., "files[1].path[0]".
+type encode_path_error struct {
+    path string
+    err error
+}
+
+func (e *encode_path_error) Error() string {
+    return fmt.Sprintf("couldn't encode %s: %s", e.path, e.err)
+}
+
+func (e *encode_path_error) Unwrap() error {
+    return e.err
+}
+
+// Prefix the path in err, if not nil, with the given path segment, as
+// wrap_coerce_path() does.
+func wrap_encode_path(segment string, err error) error {
+    if err == nil {
+        return nil
+    }
+
+    pe, ok := err.(*encode_path_error)
+    if !ok {
+        return &encode_path_error{path: segment, err: err}
+    }
+
+    return &encode_path_error{path: join_path(segment, pe.path), err: pe.err}
+}
+
+// Parsed form of a struct field tag, e.g., `bencode:"name,maxlen=255"`.
+type field_tag struct {
+    name string
+    opts map[string]string
+}
+
+func parse_field_tag(f reflect.StructField) (*field_tag) {
+    tag_val := f.Tag.Get("bencode")
+    flag_list := strings.Split(tag_val, ",")
+
+    tag := new(field_tag)
+    tag.name = flag_list[0]
+    if tag.name == "" {
+        tag.name = f.Name
+    }
+
+    tag.opts = make(map[string]string, len(flag_list) - 1)
+    for _, flag := range flag_list[1:] {
+        parts := strings.SplitN(flag, "=", 2)
+        if len(parts) == 2 {
+            tag.opts[parts[0]] = parts[1]
+        } else {
+            tag.opts[parts[0]] = ""
+        }
+    }
+
+    return tag
+}
+
+// Returns true if the tag has the given option set.
+func (tag *field_tag) has(opt string) bool {
+    _, ok := tag.opts[opt]
+    return ok
+}
+
+// Returns the integer value of the given option, if set.
+func (tag *field_tag) int_opt(opt string) (int, bool, error) {
+    val, ok := tag.opts[opt]
+    if !ok {
+        return 0, false, nil
+    }
+
+    n, err := strconv.Atoi(val)
+    if err != nil || n < 0 {
+        return 0, false, fmt.Errorf("invalid value %q for tag option %s " +
+            "on field %s", val, opt, tag.name)
+    }
+
+    return n, true, nil
+}
+
+// Enforce the maxlen and maxitems tag options against the decoded value
+// destined for the field, out.
+func check_field_limits(tag *field_tag, out *reflect.Value,
+    in reflect.Value) error {
+
+    for in.Kind() == reflect.Interface {
+        in = in.Elem()
+    }
+    if !in.IsValid() {
+        return nil
+    }
+
+    max_len, ok, err := tag.int_opt("maxlen")
+    if err != nil {
+        return wrap_coerce_error(out, in, err)
+    }
+    if ok && in.Kind() == reflect.String && in.Len() > max_len {
+        return coerce_error(in.Type(), out.Type(), "value for field %s " +
+            "exceeds maxlen %d (%d bytes)", tag.name, max_len, in.Len())
+    }
+
+    max_items, ok, err := tag.int_opt("maxitems")
+    if err != nil {
+        return wrap_coerce_error(out, in, err)
+    }
+    if ok && in.Kind() == reflect.Slice && in.Len() > max_items {
+        return coerce_error(in.Type(), out.Type(), "value for field %s " +
+            "exceeds maxitems %d (%d items)", tag.name, max_items, in.Len())
     }
 
     return nil
 }
 
-func set_val_coerce(out *reflect.Value, in reflect.Value) error {
+func (c *coercer) set_val_coerce(out *reflect.Value, in reflect.Value) error {
+    // elements of []interface{} and values of map[string]interface{} are
+    // themselves interfaces
+    for in.Kind() == reflect.Interface {
+        in = in.Elem()
+    }
+    if !in.IsValid() {
+        // a nil input value leaves the zero value
+        out.Set(reflect.Zero(out.Type()))
+        return nil
+    }
+
     out_kind := out.Kind()
     out_type := out.Type()
     in_kind := in.Kind()
@@ -215,75 +630,127 @@ func set_val_coerce(out *reflect.Value, in reflect.Value) error {
         }
     }
 
+    if raw, ok := in.Interface().(RawScalar); ok {
+        return c.set_val_coerce(out, reflect.ValueOf(raw.Value))
+    }
+
     if out_kind == reflect.Interface {
-        out.Set(reflect.ValueOf(in.Interface()))
-        return nil
-    } else {
-        if in_kind == reflect.Interface {
-            new_in := in.Elem()
-            return set_val_coerce(out, new_in)
+        if r := lookup_resolver(out_type); r != nil &&
+            in_kind == reflect.Map && in_type.Key().Kind() == reflect.String {
+
+            return c.set_val_coerce_resolved(out, in, r)
+        }
+        if !in_type.AssignableTo(out_type) {
+            return unsupported_coercion(out, in)
         }
+        out.Set(in)
+        return nil
+    }
+
+
+    if out_type == time_type {
+        return c.set_val_coerce_to_time(out, in)
+    }
+
+    if out_type == raw_dict_type {
+        return c.set_val_coerce_to_raw_dict(out, in)
     }
 
+    if out_type == big_int_type || out_type == big_int_ptr_type {
+        return c.set_val_coerce_to_big_int(out, in)
+    }
 
     switch {
     case out_kind == reflect.String:
-        return set_val_coerce_to_string(out, in)
+        return c.set_val_coerce_to_string(out, in)
     case is_kind_int(out_kind):
-        return set_val_coerce_to_int(out, in)
+        return c.set_val_coerce_to_int(out, in)
     case is_kind_float(out_kind):
-        return set_val_coerce_to_float(out, in)
+        return c.set_val_coerce_to_float(out, in)
     case out_kind == reflect.Struct:
-        return unmarshal_struct(out, in)
+        return c.unmarshal_struct(out, in)
     case out_kind == reflect.Slice:
-        return set_val_coerce_slice(out, in)
+        return c.set_val_coerce_slice(out, in)
+    case out_kind == reflect.Map:
+        return c.set_val_coerce_map(out, in)
+    case out_kind == reflect.Bool:
+        return c.set_val_coerce_to_bool(out, in)
+    case out_kind == reflect.Ptr:
+        return c.set_val_coerce_ptr(out, in)
+    case out_kind == reflect.Array:
+        return c.set_val_coerce_array(out, in)
 
     }
 
-    return fmt.Errorf("don't know how to coerce %s to %s (%s to %s) (%T to %T)",
-        in.Kind(), out.Kind(), in.Type(), out.Type(), in, out)
+    return unsupported_coercion(out, in)
 }
 
-func set_val_coerce_slice(out *reflect.Value, in reflect.Value) error {
-    in_type := in.Type()
-    out_type := out.Type()
-    in_kind := in.Kind()
-    // out_kind := out.Kind()
+// Fill the value pointed to by out, allocating it first if out is nil.
+func (c *coercer) set_val_coerce_ptr(out *reflect.Value, in reflect.Value) error {
+    if out.IsNil() {
+        out.Set(reflect.New(out.Type().Elem()))
+    }
 
-    in_length := in.Len()
-    // cap := in_length
+    elem := out.Elem()
 
-    if in_kind != reflect.Slice {
-        if in_kind == reflect.String {
-            if _, ok := in.Interface().([]byte); ok {
-                s := in.String()
-                out.Set(reflect.ValueOf([]byte(s)))
-                return nil
+    return c.set_val_coerce(&elem, in)
+}
+
+// Fill a byte array, e.g., a [20]byte hash, from a byte string of the same
+// length, or any array from a list of the same length.
+func (c *coercer) set_val_coerce_array(out *reflect.Value, in reflect.Value) error {
+    if b, ok := in.Interface().([]byte); ok {
+        in = reflect.ValueOf(string(b))
+    }
+
+    if in.Kind() == reflect.Slice {
+        if in.Len() != out.Len() {
+            return coerce_error(in.Type(), out.Type(), "list of length %d " +
+                "doesn't fit %s", in.Len(), out.Type())
+        }
+
+        for i := 0; i < in.Len(); i++ {
+            elem := out.Index(i)
+            if err := c.set_val_coerce(&elem, in.Index(i)); err != nil {
+                return wrap_coerce_path(fmt.Sprintf("[%d]", i), err)
             }
         }
-        // FIXME: stringify?
 
-        return fmt.Errorf("don't know how to coerce %T to %T",
-            in.Interface(), out.Interface())
+        return nil
     }
 
-    out_elem_type := out_type.Elem()
+    if in.Kind() != reflect.String || out.Type().Elem().Kind() != reflect.Uint8 {
+        return unsupported_coercion(out, in)
+    }
 
-    if in_length == 0 {
-        new_in := reflect.MakeSlice(out_elem_type, 0, 0)
-        out.Set(new_in)
-        return nil
+    if in.Len() != out.Len() {
+        return coerce_error(in.Type(), out.Type(), "byte string of length " +
+            "%d doesn't fit %s", in.Len(), out.Type())
     }
 
-    if in_type == out_type {
-        fmt.Fprintf(os.Stderr, "in_type == out_type: %s = %s\n", in_type, out_type)
-        out.Set(in)
-        // reflect.SliceOf(type)
-        // slice_type :=
+    reflect.Copy(*out, in)
 
-        return nil
+    return nil
+}
+
+func (c *coercer) set_val_coerce_slice(out *reflect.Value, in reflect.Value) error {
+    out_type := out.Type()
+    in_kind := in.Kind()
+
+    if in_kind != reflect.Slice {
+        if in_kind == reflect.String && out_type.Elem().Kind() == reflect.Uint8 {
+            out.SetBytes([]byte(in.String()))
+            return nil
+        }
+        // FIXME: stringify?
+
+        return coerce_error(in.Type(), out.Type(),
+            "don't know how to coerce %T to %T", in.Interface(),
+            out.Interface())
     }
 
+    in_length := in.Len()
+    out_elem_type := out_type.Elem()
 
     new_in := reflect.MakeSlice(out_type, 0, in_length)
 
@@ -292,10 +759,9 @@ func set_val_coerce_slice(out *reflect.Value, in reflect.Value) error {
         new_val_ptr := reflect.New(out_elem_type)
         new_val := new_val_ptr.Elem()
 
-        err := set_val_coerce(&new_val, elem)
+        err := c.set_val_coerce(&new_val, elem)
         if err != nil {
-            return fmt.Errorf("couldn't coerce %T(%s) to %T(%s) in slice",
-                elem.Interface(), elem.Kind(), new_val.Interface(), new_val.Kind())
+            return wrap_coerce_path(fmt.Sprintf("[%d]", i), err)
         }
 
         new_in = reflect.Append(new_in, new_val)
@@ -304,16 +770,53 @@ func set_val_coerce_slice(out *reflect.Value, in reflect.Value) error {
     out.Set(new_in)
 
     return nil
+}
+
+func (c *coercer) set_val_coerce_map(out *reflect.Value, in reflect.Value) error {
+    out_type := out.Type()
+    key_type := out_type.Key()
+    elem_type := out_type.Elem()
+
+    if in.Kind() != reflect.Map || key_type.Kind() != reflect.String {
+        return unsupported_coercion(out, in)
+    }
+
+    new_map := reflect.MakeMapWithSize(out_type, in.Len())
+
+    iter := in.MapRange()
+    for iter.Next() {
+        k := iter.Key()
+        elem := iter.Value()
+        for elem.Kind() == reflect.Interface {
+            elem = elem.Elem()
+        }
+
+        if !c.string_ints && elem.Kind() == reflect.String &&
+            is_kind_int(elem_type.Kind()) {
+            return coerce_error(elem.Type(), elem_type,
+                "won't coerce string value for key %q to %s unless string " +
+                "integers are allowed", k.String(), elem_type)
+        }
+
+        new_val := reflect.New(elem_type).Elem()
+        if err := c.set_val_coerce(&new_val, elem); err != nil {
+            return wrap_coerce_path(k.String(), err)
+        }
+
+        new_map.SetMapIndex(reflect.ValueOf(k.String()).Convert(key_type),
+            new_val)
+    }
 
-    // return fmt.Errorf("don't know how to coerce %T to %T",
-    //     in.Interface(), out.Interface())
+    out.Set(new_map)
+
+    return nil
 }
 
-func set_val_coerce_to_string(out *reflect.Value, in reflect.Value) error {
+func (c *coercer) set_val_coerce_to_string(out *reflect.Value, in reflect.Value) error {
     in_kind := in.Kind()
 
     if in_kind == reflect.String {
-        out.Set(in)
+        out.SetString(in.String())
         return nil
     }
 
@@ -322,7 +825,7 @@ func set_val_coerce_to_string(out *reflect.Value, in reflect.Value) error {
         if is_signed {
             s = strconv.FormatInt(in.Int(), 10)
         } else {
-            strconv.FormatUint(in.Uint(), 10)
+            s = strconv.FormatUint(in.Uint(), 10)
         }
         out.SetString(s)
 
@@ -344,12 +847,13 @@ func set_val_coerce_to_string(out *reflect.Value, in reflect.Value) error {
         }
     }
 
-    return fmt.Errorf("don't know how to coerce %s to %s (%s to %s) (%T to %T)",
+    return coerce_error(in.Type(), out.Type(),
+        "don't know how to coerce %s to %s (%s to %s) (%T to %T)",
         in.Kind(), out.Kind(), in.Type(), out.Type(),
         in.Interface(), out.Interface())
 }
 
-func set_val_coerce_to_float(out *reflect.Value, in reflect.Value) error {
+func (c *coercer) set_val_coerce_to_float(out *reflect.Value, in reflect.Value) error {
     in_kind := in.Kind()
     if is_kind_float(in_kind) {
         out.SetFloat(in.Float())
@@ -359,7 +863,7 @@ func set_val_coerce_to_float(out *reflect.Value, in reflect.Value) error {
     if in_kind == reflect.String {
         in_float, err := strconv.ParseFloat(in.String(), 64)
         if err != nil {
-            return err
+            return wrap_coerce_error(out, in, err)
         }
         out.SetFloat(in_float)
         return nil
@@ -376,84 +880,101 @@ func set_val_coerce_to_float(out *reflect.Value, in reflect.Value) error {
         return nil
     }
 
-    return fmt.Errorf("don't know how to coerce %s to %s (%s to %s)",
-        in.Kind(), out.Kind(), in.Type(), out.Type())
+    return unsupported_coercion(out, in)
 }
 
-func set_val_coerce_to_int(out *reflect.Value, in reflect.Value) error {
-    out_kind := out.Kind()
-    out_type := out.Type()
+func (c *coercer) set_val_coerce_to_int(out *reflect.Value, in reflect.Value) error {
     in_kind := in.Kind()
-    in_type := in.Type()
-
-    if in_kind == out_kind {
-        out.Set(in)
-        return nil
-    }
 
     if in_is_signed, ok := get_int_kind(in_kind); ok {
-        return set_val_coerce_int_to_int(out, in, in_is_signed)
+        return c.set_val_coerce_int_to_int(out, in, in_is_signed)
     }
 
     switch in_kind {
     case reflect.String:
-        return set_val_coerce_string_to_int(out, in)
+        return c.set_val_coerce_string_to_int(out, in)
     }
 
-    return fmt.Errorf("don't know how to coerce %s to %s (%s to %s)",
-        in_kind, out_kind, in_type, out_type)
+    return unsupported_coercion(out, in)
 }
 
-func set_val_coerce_int_to_int(out *reflect.Value, in reflect.Value,
+func (c *coercer) set_val_coerce_int_to_int(out *reflect.Value, in reflect.Value,
     in_is_signed bool) error {
 
     switch out.Kind() {
     case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        if !in_is_signed && in.Uint() > math.MaxInt64 {
+            return int_overflow_error(out, in)
+        }
+
+        var n int64
         if in_is_signed {
-            out.SetInt(in.Int())
+            n = in.Int()
         } else {
-            out.SetInt(int64(in.Uint()))
+            n = int64(in.Uint())
         }
+        if out.OverflowInt(n) {
+            return int_overflow_error(out, in)
+        }
+        out.SetInt(n)
 
     case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        if in_is_signed && in.Int() < 0 {
+            return int_overflow_error(out, in)
+        }
+
+        var n uint64
         if in_is_signed {
-            out.SetUint(uint64(in.Int()))
+            n = uint64(in.Int())
         } else {
-            out.SetUint(in.Uint())
+            n = in.Uint()
+        }
+        if out.OverflowUint(n) {
+            return int_overflow_error(out, in)
         }
+        out.SetUint(n)
 
     default:
-        return fmt.Errorf("don't know how to coerce %s to %s (%s to %s)",
-            in.Kind(), out.Kind(), in.Type(), out.Type())
+        return unsupported_coercion(out, in)
     }
 
     return nil
 }
 
-func set_val_coerce_string_to_int(out *reflect.Value, in reflect.Value) error {
+func (c *coercer) set_val_coerce_string_to_int(out *reflect.Value, in reflect.Value) error {
     switch out.Kind() {
     case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
         the_int, err := strconv.ParseInt(in.String(), 10, 64)
         if err != nil {
-            return err
+            return wrap_coerce_error(out, in, err)
+        }
+        if out.OverflowInt(the_int) {
+            return int_overflow_error(out, in)
         }
         out.SetInt(the_int)
 
     case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
         the_uint, err := strconv.ParseUint(in.String(), 10, 64)
         if err != nil {
-            return err
+            return wrap_coerce_error(out, in, err)
+        }
+        if out.OverflowUint(the_uint) {
+            return int_overflow_error(out, in)
         }
         out.SetUint(the_uint)
 
     default:
-        return fmt.Errorf("don't know how to coerce %s to %s (%s to %s)",
-            in.Kind(), out.Kind(), in.Type(), out.Type())
+        return unsupported_coercion(out, in)
     }
 
     return nil
 }
 
+func int_overflow_error(out *reflect.Value, in reflect.Value) error {
+    return coerce_error(in.Type(), out.Type(), "value %v overflows %s",
+        in.Interface(), out.Type())
+}
+
 func is_kind_float(kind reflect.Kind) bool {
     switch kind {
     case reflect.Float32, reflect.Float64:
@@ -494,26 +1015,77 @@ func DecodeString(s string) (interface{}, error) {
      return Decode(r)
 }
 
+// Decode a Bencode data structure provided as a byte slice, data, without
+// copying it to a string first.
+func DecodeBytes(data []byte) (interface{}, error) {
+    r := bytes.NewReader(data)
+    return Decode(r)
+}
+
+// Buffers for EncodeToString() and Marshal().
+var buffer_pool = sync.Pool{
+    New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// Buffers larger than this are not returned to buffer_pool, so that one large
+// value doesn't pin its memory for good.
+const max_pooled_buffer = 64 * 1024
+
+// Encode v into a buffer from buffer_pool. The buffer must be passed to
+// put_buffer() once its contents have been copied out.
+func encode_pooled(v interface{}) (*bytes.Buffer, error) {
+    buf := buffer_pool.Get().(*bytes.Buffer)
+    buf.Reset()
+
+    err := NewEncoder(buf).Encode(v)
+    if err != nil {
+        put_buffer(buf)
+        return nil, err
+    }
+
+    return buf, nil
+}
+
+func put_buffer(buf *bytes.Buffer) {
+    if buf.Cap() <= max_pooled_buffer {
+        buffer_pool.Put(buf)
+    }
+}
+
 // Encode a data structure, v,  to a string.
 func EncodeToString(v interface{}) (string, error) {
-    buf := new(bytes.Buffer)
-    enc := NewEncoder(buf)
-
-    err := enc.Encode(v)
+    buf, err := encode_pooled(v)
     if err != nil {
         return "", err
     }
+    defer put_buffer(buf)
 
+    // String() copies the contents, so the result doesn't alias the buffer
     return buf.String(), nil
 }
 
+// Encode a data structure, v, and return the Bencode data.
+func Marshal(v interface{}) ([]byte, error) {
+    buf, err := encode_pooled(v)
+    if err != nil {
+        return nil, err
+    }
+    defer put_buffer(buf)
+
+    data := make([]byte, buf.Len())
+    copy(data, buf.Bytes())
+
+    return data, nil
+}
+
 // Encode the given data structure, v, to the Writer, w.
 func Encode(w io.Writer, v interface{}) (error) {
     enc := NewEncoder(w)
     return enc.Encode(v)
 }
 
-// Decode a Bencode data structure from the Reader, r.
+// Decode a Bencode data structure from the Reader, r. Empty input decodes
+// as nil with no error. See DecodeNonEmpty().
 func Decode(r io.Reader) (interface{}, error) {
     dec := NewDecoder(r)
     v, err := dec.Decode()
@@ -525,10 +1097,37 @@ func Decode(r io.Reader) (interface{}, error) {
     return v, err
 }
 
+// Decode a Bencode data structure from the Reader, r, as Decode() does, but
+// return ErrEmptyInput if r holds no value at all.
+func DecodeNonEmpty(r io.Reader) (interface{}, error) {
+    dec := NewDecoder(r)
+    v, err := dec.Decode()
+
+    if err == io.EOF {
+        err = ErrEmptyInput
+    }
+
+    return v, err
+}
+
 func (r *breader) Read(p []byte) (n int, err error) {
+    if r.max_read > 0 {
+        if r.pos >= r.limit {
+            return 0, syntax_error(r.pos, "exceeded maximum input size of " +
+                "%d bytes at byte %d", r.max_read, r.pos)
+        }
+        if uint64(len(p)) > r.limit - r.pos {
+            p = p[:r.limit - r.pos]
+        }
+    }
+
     n, err = r.r.Read(p)
     r.pos += uint64(n)
 
+    for _, rec := range r.recs {
+        rec.Write(p[:n])
+    }
+
     return n, err
 }
 
@@ -536,11 +1135,41 @@ func (r *breader) UnreadByte() error {
     err := r.r.UnreadByte()
     if err == nil {
         r.pos -= 1
+
+        for _, rec := range r.recs {
+            rec.Truncate(rec.Len() - 1)
+        }
     }
 
     return err
 }
 
+// Start recording the bytes read. Recordings may be nested, and each must be
+// ended with a call to stop_record().
+func (r *breader) start_record() {
+    r.recs = append(r.recs, new(bytes.Buffer))
+}
+
+// Stop the innermost recording and return the bytes read since it started.
+func (r *breader) stop_record() []byte {
+    rec := r.recs[len(r.recs) - 1]
+    r.recs = r.recs[:len(r.recs) - 1]
+
+    return rec.Bytes()
+}
+
+// Return the next n bytes without consuming them.
+func (r *breader) Peek(n int) ([]byte, error) {
+    return r.r.Peek(n)
+}
+
+// Allow at most n more bytes to be read, counting from pos, or remove the
+// limit if n is 0.
+func (r *breader) limit_reads(pos uint64, n int64) {
+    r.max_read = n
+    r.limit = pos + uint64(n)
+}
+
 func (r *breader) Tell() uint64 {
     return r.pos
 }
@@ -555,7 +1184,7 @@ func new_reader (r io.Reader) (*breader) {
 // Create a new Encoder to encode data structures to Bencode.
 func NewEncoder(w io.Writer) *Encoder {
     enc := new(Encoder)
-    enc.w = w
+    enc.set_writer(w)
 
     return enc
 }
@@ -564,56 +1193,271 @@ func NewEncoder(w io.Writer) *Encoder {
 func NewDecoder(r io.Reader) *Decoder {
     dec := new(Decoder)
     dec.r = new_reader(r)
+    dec.max_depth = DefaultMaxDepth
 
     return dec
 }
 
+// Discard any state and buffered data, and continue decoding from r with the
+// same options, e.g., to reuse the Decoder's buffer for many small inputs.
+func (dec *Decoder) Reset(r io.Reader) {
+    dec.r.r.Reset(r)
+    dec.r.pos = 0
+    dec.r.recs = nil
+    dec.depth = 0
+    dec.max_depth_seen = 0
+    dec.path = dec.path[:0]
+    dec.str_reader = nil
+    dec.peeked = nil
+    dec.dict_spans = nil
+    dec.dict_base = 0
+    dec.coercer.raw_dicts = nil
+}
+
+// Discard any state and continue encoding to w with the same options. Counts
+// of duplicated byte strings being tracked with TrackDuplicates() are
+// cleared.
+func (enc *Encoder) Reset(w io.Writer) {
+    tw, tracing := enc.w.(*trace_writer)
+    enc.set_writer(w)
+    if tracing {
+        enc.w = &trace_writer{w: enc.w, trace: tw.trace}
+    }
+    enc.path = enc.path[:0]
+    enc.stream = enc.stream[:0]
+    for s := range enc.string_counts {
+        delete(enc.string_counts, s)
+    }
+}
+
+// Write to w through a bufio.Writer, so that the many small writes made
+// while encoding don't each reach w, e.g., as a system call on a socket.
+// Writers that already buffer are used as is.
+func (enc *Encoder) set_writer(w io.Writer) {
+    switch w.(type) {
+    case *bufio.Writer, *bytes.Buffer:
+        enc.buf = nil
+        enc.w = w
+        return
+    }
+
+    enc.sink = &counting_writer{w: w}
+    if enc.buf == nil {
+        enc.buf = bufio.NewWriter(enc.sink)
+    } else {
+        enc.buf.Reset(enc.sink)
+    }
+    enc.w = enc.buf
+}
+
+// Write out any data buffered by the Encoder to the underlying Writer. This
+// is done after each call to Encode() and when the outermost list or
+// dictionary opened with StartList() or StartDict() is closed, so it is only
+// needed to send part of a streamed value early. A Writer passed to
+// NewEncoder() that is already a *bufio.Writer is not flushed.
+func (enc *Encoder) Flush() error {
+    if enc.buf == nil {
+        return nil
+    }
+
+    return enc.buf.Flush()
+}
+
+// Flush the buffered output, unless a streamed value is still open, and
+// return err or, if there was none, any error from flushing.
+func (enc *Encoder) flush(err error) error {
+    if len(enc.stream) > 0 {
+        return err
+    }
+
+    if ferr := enc.Flush(); err == nil {
+        err = ferr
+    }
+
+    return err
+}
+
+// Set the maximum nesting depth of lists and dictionaries the Decoder will
+// accept before returning an error. This protects against input crafted to
+// exhaust the stack. A value of 0 means no limit. The default is
+// DefaultMaxDepth.
+func (dec *Decoder) SetMaxDepth(depth int) {
+    dec.max_depth = depth
+}
+
+// Replace the values of the given dictionary keys with placeholder when
+// encoding. This applies to matching keys at any nesting level, and is useful
+// for producing a shareable representation of data that contains secrets,
+// e.g., a private tracker passkey.
+func (enc *Encoder) Redact(placeholder string, keys ...string) {
+    if enc.redacted == nil {
+        enc.redacted = make(map[string]bool, len(keys))
+    }
+
+    for _, k := range keys {
+        enc.redacted[k] = true
+    }
+    enc.redact_placeholder = placeholder
+}
+
+// Start counting the byte strings of at least min_len bytes that are
+// encoded, so that repeated large values can be found with
+// DuplicateStrings(). Bencode has no way to refer back to an earlier value,
+// so this is meant to help restructure data that repeats itself.
+func (enc *Encoder) TrackDuplicates(min_len int) {
+    enc.dup_min_len = min_len
+    enc.string_counts = make(map[string]int)
+}
+
+// Return the number of times each byte string counted since
+// TrackDuplicates() was called was encoded, for those encoded more than once.
+func (enc *Encoder) DuplicateStrings() map[string]int {
+    dups := make(map[string]int)
+    for s, count := range enc.string_counts {
+        if count > 1 {
+            dups[s] = count
+        }
+    }
+
+    return dups
+}
+
+func (enc *Encoder) count_string(s string) {
+    if enc.dup_min_len > 0 && len(s) >= enc.dup_min_len {
+        enc.string_counts[s]++
+    }
+}
+
+// Set a function that gives the dictionary key for a struct field that has
+// no tag name, e.g., to map "PublisherWebpage" to "publisher-webpage". Tag
+// names are used as-is.
+func (enc *Encoder) SetKeyMapper(fn func(field_name string) string) {
+    enc.key_mapper = fn
+}
+
+// Set a function to be called as each dictionary key is written, e.g., for
+// instrumenting which keys are emitted. The path holds the dictionary keys
+// and list indices (in decimal) leading to the dictionary containing key.
+// Keys are reported in output order. The path slice is reused, so copy it if
+// it needs to be retained.
+func (enc *Encoder) SetKeyHook(fn func(path []string, key string)) {
+    enc.key_hook = fn
+}
+
 // Encode the given data structure, v, to Bencode on the Writer provided to
-// NewEncoder().
+// NewEncoder(). The output is buffered and flushed to the Writer before
+// Encode() returns. See Flush().
+//
+// A struct is encoded as a dictionary keyed by the name given in each
+// field's `bencode` struct tag, or by the field name if there is none, the
+// same names FillData() matches, so that structs round-trip. Unexported
+// fields and fields tagged "-" are skipped. Note that earlier versions keyed
+// every field by its Go field name, ignoring tags, and failed on structs with
+// unexported fields.
+//
+// Bencode has no null value, so encoding a nil pointer or interface returns
+// ErrEncodeNil. Struct fields holding nil pointers or interfaces are skipped
+// if tagged omitempty, and are an error otherwise. Nil maps and slices are
+// encoded as empty dictionaries and lists. A field tagged omitnil is skipped
+// only when nil, so that, unlike with omitempty, an empty but non-nil map or
+// slice is still written, e.g., to distinguish an empty file list from a
+// missing one:
+//
+//     Files []File `bencode:"files,omitnil"`
+//
+// A struct with a BencodeExtra() map[string]interface{} method, on its value
+// or pointer type, has the entries returned added to its dictionary, e.g.,
+// for computed values. A key that collides with one of its fields is an
+// error.
+//
+// A channel that can be received from is encoded as a list of the values
+// received from it. Encode() blocks until the channel is closed.
 func (enc *Encoder) Encode(v interface{}) (error) {
+    return enc.flush(enc.encode(v))
+}
+
+func (enc *Encoder) encode(v interface{}) (error) {
     vt, ok := v.(reflect.Value)
     if ok {
         v = vt.Interface()
     }
 
+    if v == nil {
+        return ErrEncodeNil
+    }
+
+    if handled, err := enc.encode_fast(v); handled {
+        return err
+    }
+
+    if raw, ok := v.(RawScalar); ok {
+        _, err := enc.w.Write(raw.Raw)
+        return err
+    }
+
+    if t, ok := v.(time.Time); ok {
+        return enc.encode(time_to_int(t, enc.time_unit))
+    }
+
+    if n, ok := v.(Number); ok {
+        if !valid_number(string(n)) {
+            return fmt.Errorf("invalid Number %q for encoding", string(n))
+        }
+        _, err := fmt.Fprintf(enc.w, "i%se", string(n))
+        return err
+    }
+
+    if b, ok := v.(*big.Int); ok {
+        if b == nil {
+            return ErrEncodeNil
+        }
+        fmt.Fprintf(enc.w, "i%se", b.String())
+        return nil
+    }
+
+    if b, ok := v.(big.Int); ok {
+        fmt.Fprintf(enc.w, "i%se", b.String())
+        return nil
+    }
+
+    if rd, ok := v.(RawDict); ok {
+        if rd.Raw != nil {
+            _, err := enc.w.Write(rd.Raw)
+            return err
+        }
+        return enc.encode(rd.Map)
+    }
+
+    if pairs, ok := v.(Pairs); ok {
+        return enc.encode_pairs(pairs)
+    }
+
+    if od, ok := v.(ordered_dict); ok {
+        return enc.write_dict(od.dict_keys(), od.dict_value)
+    }
+
     this_type := reflect.TypeOf(v)
     this_kind := this_type.Kind()
 
     switch this_kind {
-    case reflect.Interface:
-        ival := reflect.ValueOf(v).Elem()
-        return enc.Encode(ival)
-
-    case reflect.Int:
-        fmt.Fprintf(enc.w, "i%de", v.(int))
-    case reflect.Int8:
-        fmt.Fprintf(enc.w, "i%de", v.(int8))
-    case reflect.Int16:
-        fmt.Fprintf(enc.w, "i%de", v.(int16))
-    case reflect.Int32:
-        fmt.Fprintf(enc.w, "i%de", v.(int32))
-    case reflect.Int64:
-        fmt.Fprintf(enc.w, "i%de", v.(int64))
-    case reflect.Uint:
-        fmt.Fprintf(enc.w, "i%de", v.(uint))
-    case reflect.Uint8:
-        fmt.Fprintf(enc.w, "i%de", v.(uint8))
-    case reflect.Uint16:
-        fmt.Fprintf(enc.w, "i%de", v.(uint16))
-    case reflect.Uint32:
-        fmt.Fprintf(enc.w, "i%de", v.(uint32))
-    case reflect.Uint64:
-        fmt.Fprintf(enc.w, "i%de", v.(uint64))
+    // use reflect accessors, so named types like time.Month work as well
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        fmt.Fprintf(enc.w, "i%de", reflect.ValueOf(v).Int())
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        fmt.Fprintf(enc.w, "i%de", reflect.ValueOf(v).Uint())
+
+    case reflect.Bool:
+        return enc.encode_bool(reflect.ValueOf(v).Bool())
 
     case reflect.Float32:
-        f32 := fmt.Sprintf("%f", v.(float32))
-        if err := enc.Encode(f32); err != nil {
+        f32 := strconv.FormatFloat(reflect.ValueOf(v).Float(), 'g', -1, 32)
+        if err := enc.encode(f32); err != nil {
             return err
         }
 
     case reflect.Float64:
-        f64 := fmt.Sprintf("%f", v.(float64))
-        if err := enc.Encode(f64); err != nil {
+        f64 := strconv.FormatFloat(reflect.ValueOf(v).Float(), 'g', -1, 64)
+        if err := enc.encode(f64); err != nil {
             return err
         }
 
@@ -627,19 +1471,28 @@ func (enc *Encoder) Encode(v interface{}) (error) {
         return enc.encode_slice(v)
 
     case reflect.String:
-        s := v.(string)
+        s := reflect.ValueOf(v).String()
+        enc.count_string(s)
         fmt.Fprintf(enc.w, "%d:%s", len(s), s)
 
     case reflect.Array:
         return enc.encode_array(v)
 
+    case reflect.Chan:
+        return enc.encode_chan(v)
+
     case reflect.Ptr:
-        elem := reflect.ValueOf(v).Elem()
-        if ! elem.IsValid() {
-            return enc.Encode("nil")
+        // follow chains of pointers, and pointers to interfaces, down to the
+        // value they point to
+        elem := reflect.ValueOf(v)
+        for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+            if elem.IsNil() {
+                return ErrEncodeNil
+            }
+            elem = elem.Elem()
         }
 
-        return enc.Encode(elem)
+        return enc.encode(elem)
 
     default:
         return fmt.Errorf("invalid data type for encoding: %s",
@@ -657,7 +1510,14 @@ func (enc *Encoder) encode_map(v interface{}) (error) {
 
     // keys in a map are required to be strings in bencode
     for _, k := range keys {
-        skey := fmt.Sprintf("%s", k)
+        skey, err := map_key_string(k)
+        if err != nil {
+            return err
+        }
+        if _, ok := new_map[skey]; ok {
+            return fmt.Errorf("map key %v collides with another key as " +
+                "dictionary key %q", k, skey)
+        }
         map_keys = append(map_keys, skey)
 
         new_map[skey] = m.MapIndex(k).Interface()
@@ -666,19 +1526,191 @@ func (enc *Encoder) encode_map(v interface{}) (error) {
     // keys must be in lexical order
     sort.Strings(map_keys)
 
-    w := enc.w
-    w.Write([]byte{'d'})
-    for _, k := range map_keys {
-        err := enc.Encode(k)
-        if err != nil {
+    return enc.write_dict(map_keys, func(k string) interface{} {
+        return new_map[k]
+    })
+}
+
+// Encode the most common concrete types, e.g., those returned by Decode(),
+// without reflection. Return false if v is not one of them.
+func (enc *Encoder) encode_fast(v interface{}) (bool, error) {
+    switch val := v.(type) {
+    case string:
+        return true, enc.write_string(val)
+    case int:
+        return true, enc.write_int(int64(val))
+    case int64:
+        return true, enc.write_int(val)
+    case []byte:
+        return true, enc.write_bytes(val)
+
+    case map[string]interface{}:
+        keys := make([]string, 0, len(val))
+        for k := range val {
+            keys = append(keys, k)
+        }
+        sort.Strings(keys)
+
+        return true, enc.write_dict(keys, func(k string) interface{} {
+            return val[k]
+        })
+
+    case map[string]string:
+        return true, write_scalar_map(enc, val, enc.write_string)
+    case map[string]int64:
+        return true, write_scalar_map(enc, val, enc.write_int)
+
+    case []interface{}:
+        enc.w.Write([]byte{'l'})
+        for i, elem := range val {
+            if enc.key_hook != nil {
+                enc.push_path(strconv.Itoa(i))
+            }
+            err := enc.encode(elem)
+            enc.pop_path()
+            if err != nil {
+                return true, wrap_encode_path(fmt.Sprintf("[%d]", i), err)
+            }
+        }
+        _, err := enc.w.Write([]byte{'e'})
+
+        return true, err
+    }
+
+    return false, nil
+}
+
+// Write a map of scalar values as a dictionary, writing each value directly
+// with write rather than boxing it in an interface{} for Encode().
+func write_scalar_map[V any](enc *Encoder, m map[string]V,
+    write func(V) error) error {
+
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+
+    enc.w.Write([]byte{'d'})
+    for _, k := range keys {
+        if enc.key_hook != nil {
+            enc.key_hook(enc.path, k)
+        }
+        if err := enc.write_string(k); err != nil {
             return err
         }
 
-        err = enc.Encode(new_map[k])
+        var err error
+        if enc.redacted[k] {
+            err = enc.write_string(enc.redact_placeholder)
+        } else {
+            err = write(m[k])
+        }
         if err != nil {
             return err
         }
+    }
+    _, err := enc.w.Write([]byte{'e'})
+
+    return err
+}
+
+// Write s as a byte string.
+func (enc *Encoder) write_string(s string) error {
+    enc.count_string(s)
 
+    enc.scratch = strconv.AppendInt(enc.scratch[:0], int64(len(s)), 10)
+    enc.scratch = append(enc.scratch, ':')
+    if _, err := enc.w.Write(enc.scratch); err != nil {
+        return err
+    }
+
+    _, err := io.WriteString(enc.w, s)
+
+    return err
+}
+
+// Write b as a byte string.
+func (enc *Encoder) write_bytes(b []byte) error {
+    if enc.dup_min_len > 0 {
+        enc.count_string(string(b))
+    }
+
+    enc.scratch = strconv.AppendInt(enc.scratch[:0], int64(len(b)), 10)
+    enc.scratch = append(enc.scratch, ':')
+    if _, err := enc.w.Write(enc.scratch); err != nil {
+        return err
+    }
+
+    _, err := enc.w.Write(b)
+
+    return err
+}
+
+// Write n as an integer.
+func (enc *Encoder) write_int(n int64) error {
+    enc.scratch = append(enc.scratch[:0], 'i')
+    enc.scratch = strconv.AppendInt(enc.scratch, n, 10)
+    enc.scratch = append(enc.scratch, 'e')
+
+    _, err := enc.w.Write(enc.scratch)
+
+    return err
+}
+
+// Encode v, as Encode() does, and return the number of bytes written, e.g.,
+// for length-prefixed framing or accounting when writing many values to one
+// stream. The count includes any bytes written before an error.
+func (enc *Encoder) EncodeN(v interface{}) (int64, error) {
+    if enc.buf == nil {
+        cw := &counting_writer{w: enc.w}
+        enc.w = cw
+        defer func() { enc.w = cw.w }()
+
+        err := enc.encode(v)
+
+        return cw.n, err
+    }
+
+    // count the bytes as they are flushed to the underlying Writer, so that
+    // only bytes actually written are counted
+    if err := enc.buf.Flush(); err != nil {
+        return 0, err
+    }
+    start := enc.sink.n
+
+    err := enc.encode(v)
+    if ferr := enc.buf.Flush(); err == nil {
+        err = ferr
+    }
+
+    return enc.sink.n - start, err
+}
+
+// Counts the bytes written to the underlying Writer.
+type counting_writer struct {
+    w io.Writer
+    n int64
+}
+
+func (cw *counting_writer) Write(p []byte) (int, error) {
+    n, err := cw.w.Write(p)
+    cw.n += int64(n)
+
+    return n, err
+}
+
+// Write a dictionary with the given keys, in the order given, getting the
+// value for each key from get_val.
+func (enc *Encoder) write_dict(keys []string,
+    get_val func(k string) interface{}) error {
+
+    w := enc.w
+    w.Write([]byte{'d'})
+    for _, k := range keys {
+        if err := enc.write_dict_entry(k, get_val(k)); err != nil {
+            return err
+        }
     }
     w.Write([]byte{'e'})
 
@@ -686,32 +1718,235 @@ func (enc *Encoder) encode_map(v interface{}) (error) {
     return nil
 }
 
+// Write a single key/value pair inside a dictionary, applying the key hook
+// and redaction.
+func (enc *Encoder) write_dict_entry(k string, v interface{}) error {
+    if enc.key_hook != nil {
+        enc.key_hook(enc.path, k)
+    }
+
+    err := enc.encode(k)
+    if err != nil {
+        return err
+    }
+
+    enc.push_path(k)
+    if enc.redacted[k] {
+        err = enc.encode(enc.redact_placeholder)
+    } else {
+        err = enc.encode(v)
+    }
+    enc.pop_path()
+
+    return wrap_encode_path(k, err)
+}
+
+// Convert a map key to the byte string used as its dictionary key. Keys
+// implementing fmt.Stringer use their String() method, and integer keys are
+// formatted in decimal. Keys of interface type, e.g., in a
+// map[interface{}]interface{}, are converted according to the type they hold.
+func map_key_string(k reflect.Value) (string, error) {
+    for k.Kind() == reflect.Interface {
+        if k.IsNil() {
+            return "", fmt.Errorf("unsupported nil map key for encoding")
+        }
+        k = k.Elem()
+    }
+
+    if stringer, ok := k.Interface().(fmt.Stringer); ok {
+        return stringer.String(), nil
+    }
+
+    switch {
+    case k.Kind() == reflect.String:
+        return k.String(), nil
+    case is_kind_int(k.Kind()):
+        if is_signed, _ := get_int_kind(k.Kind()); is_signed {
+            return strconv.FormatInt(k.Int(), 10), nil
+        }
+        return strconv.FormatUint(k.Uint(), 10), nil
+    }
+
+    return "", fmt.Errorf("unsupported map key type %s for encoding: " +
+        "keys must be strings, integers, or implement fmt.Stringer", k.Type())
+}
+
+// Sort dictionary keys in canonical order, i.e., as raw byte strings using
+// unsigned byte comparison, regardless of any UTF-8 content.
 func (enc *Encoder) encode_struct(v interface{}) (error) {
-    t := reflect.TypeOf(v)
     val := reflect.ValueOf(v)
 
     field_map := make(map[string]interface{}, val.NumField())
+    var extra reflect.Value
+    fields := struct_fields(val.Type(), enc.key_mapper)
+
+    for _, f := range fields {
+        tag := f.tag
+        if tag.has("extra") {
+            extra, _ = field_by_index(val, f.index)
+            continue
+        }
+
+        fv, ok := field_by_index(val, f.index)
+        if !ok {
+            // inside a nil embedded struct pointer
+            continue
+        }
+        if (tag.has("omitempty") || enc.omit_empty) && is_empty_value(fv) {
+            continue
+        }
+        if tag.has("omitnil") && is_omitnil_value(fv) {
+            continue
+        }
 
-    for i := 0; i < t.NumField(); i++ {
-        f := t.Field(i)
-        fv := val.Field(i)
+        if is_nil_value(fv) {
+            return fmt.Errorf("nil value for field %s (tag it omitempty to " +
+                "skip it): %w", tag.name, ErrEncodeNil)
+        }
 
-        field_map[f.Name] = fv
+        if tag.has("json") {
+            v, err := json_field_value(fv)
+            if err != nil {
+                return fmt.Errorf("error converting field %s from JSON: %w",
+                    tag.name, err)
+            }
+            field_map[tag.name] = v
+            continue
+        }
+
+        if unit, ok := tag.time_unit(); ok && fv.Type() == time_type {
+            field_map[tag.name] = time_to_int(fv.Interface().(time.Time), unit)
+            continue
+        }
+
+        field_map[tag.name] = fv
+    }
+
+    if extra.IsValid() && extra.Kind() == reflect.Map {
+        // fields take precedence over extra keys
+        iter := extra.MapRange()
+        for iter.Next() {
+            k, err := map_key_string(iter.Key())
+            if err != nil {
+                return err
+            }
+            if _, ok := field_map[k]; !ok {
+                field_map[k] = iter.Value()
+            }
+        }
+    }
+
+    if p, ok := extra_provider_of(val); ok {
+        declared := make(map[string]bool, len(fields))
+        for _, f := range fields {
+            if !f.tag.has("extra") {
+                declared[f.tag.name] = true
+            }
+        }
+
+        for k, v := range p.BencodeExtra() {
+            _, exists := field_map[k]
+            if exists || declared[k] {
+                return fmt.Errorf("key %q from BencodeExtra() collides " +
+                    "with a field of %s", k, val.Type())
+            }
+            field_map[k] = v
+        }
     }
 
     return enc.encode_map(field_map)
 }
 
+// Types with a BencodeExtra() method have the entries it returns added to
+// the dictionary their fields are encoded as.
+type extra_provider interface {
+    BencodeExtra() map[string]interface{}
+}
+
+var extra_provider_type = reflect.TypeOf((*extra_provider)(nil)).Elem()
+
+// Return the extra_provider for the struct val, including through a method
+// with a pointer receiver.
+func extra_provider_of(val reflect.Value) (extra_provider, bool) {
+    if val.Type().Implements(extra_provider_type) {
+        return val.Interface().(extra_provider), true
+    }
+
+    if !reflect.PtrTo(val.Type()).Implements(extra_provider_type) {
+        return nil, false
+    }
+
+    if !val.CanAddr() {
+        addressable := reflect.New(val.Type()).Elem()
+        addressable.Set(val)
+        val = addressable
+    }
+
+    return val.Addr().Interface().(extra_provider), true
+}
+
+// Report whether v is a nil pointer or interface, which can't be encoded.
+func is_nil_value(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        return v.IsNil()
+    }
+
+    return false
+}
+
+// Report whether v is nil for the purposes of omitnil: a nil pointer,
+// interface, map, or slice.
+func is_omitnil_value(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+        return v.IsNil()
+    }
+
+    return false
+}
+
+// Report whether v is empty for the purposes of omitempty: false, 0, an
+// empty string, a nil pointer or interface, or an empty map, slice, or
+// array.
+func is_empty_value(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+        return v.Len() == 0
+    case reflect.Bool:
+        return !v.Bool()
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return v.Int() == 0
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return v.Uint() == 0
+    case reflect.Float32, reflect.Float64:
+        return v.Float() == 0
+    case reflect.Ptr, reflect.Interface:
+        return v.IsNil()
+    }
+
+    return false
+}
+
 func (enc *Encoder) encode_slice(v interface{}) (error) {
     obj := reflect.ValueOf(v)
 
+    if obj.Kind() == reflect.Slice && obj.Type().Elem().Kind() == reflect.Uint8 {
+        // byte slices, including named types, are byte strings
+        return enc.write_bytes(obj.Bytes())
+    }
+
     w := enc.w
     w.Write([]byte{'l'})
 
     for i := 0; i < obj.Len(); i++ {
-        err := enc.Encode(obj.Index(i).Interface())
+        if enc.key_hook != nil {
+            enc.push_path(strconv.Itoa(i))
+        }
+        err := enc.encode(obj.Index(i).Interface())
+        enc.pop_path()
         if err != nil {
-            return err
+            return wrap_encode_path(fmt.Sprintf("[%d]", i), err)
         }
     }
 
@@ -720,111 +1955,514 @@ func (enc *Encoder) encode_slice(v interface{}) (error) {
     return nil
 }
 
+// Track the path to the value being encoded, if anything needs it.
+func (enc *Encoder) push_path(elem string) {
+    if enc.key_hook != nil {
+        enc.path = append(enc.path, elem)
+    }
+}
+
+func (enc *Encoder) pop_path() {
+    if len(enc.path) > 0 {
+        enc.path = enc.path[:len(enc.path) - 1]
+    }
+}
+
 func (enc *Encoder) encode_array(v interface{}) (error) {
+    obj := reflect.ValueOf(v)
+
+    if obj.Type().Elem().Kind() == reflect.Uint8 {
+        // byte arrays, e.g., [20]byte hashes, are byte strings
+        b := make([]byte, obj.Len())
+        reflect.Copy(reflect.ValueOf(b), obj)
+
+        return enc.write_bytes(b)
+    }
+
     return enc.encode_slice(v)
 }
 
+// Write the values received from a channel as a list, until the channel is
+// closed. If a value can't be encoded, the rest of the channel is left
+// unread.
+func (enc *Encoder) encode_chan(v interface{}) (error) {
+    ch := reflect.ValueOf(v)
+    if ch.Type().ChanDir() & reflect.RecvDir == 0 {
+        return fmt.Errorf("invalid data type for encoding: send-only %s",
+            ch.Type())
+    }
+
+    enc.w.Write([]byte{'l'})
+    for i := 0; ; i++ {
+        elem, ok := ch.Recv()
+        if !ok {
+            break
+        }
+
+        if enc.key_hook != nil {
+            enc.push_path(strconv.Itoa(i))
+        }
+        err := enc.encode(elem.Interface())
+        enc.pop_path()
+        if err != nil {
+            return wrap_encode_path(fmt.Sprintf("[%d]", i), err)
+        }
+    }
+    _, err := enc.w.Write([]byte{'e'})
+
+    return err
+}
+
+
+// Return the input stream byte offset of the current decoder position, i.e.,
+// the number of bytes consumed so far. When decoding a stream of concatenated
+// values, this is the offset of the end of the last value decoded.
+func (dec *Decoder) InputOffset() int64 {
+    if dec.peeked != nil {
+        return int64(dec.peeked.start)
+    }
+
+    return int64(dec.r.Tell())
+}
+
+// Return the maximum nesting depth of lists and dictionaries encountered by
+// the last call to Decode(), e.g., 0 for a scalar and 1 for a flat list.
+// This is useful for choosing a limit to pass to SetMaxDepth().
+func (dec *Decoder) MaxDepthSeen() int {
+    return dec.max_depth_seen
+}
+
+// Set the maximum length of a byte string the Decoder will accept. Longer
+// length prefixes are rejected before any memory is allocated for the string,
+// protecting against hostile input claiming huge lengths. A value of 0 (the
+// default) means no limit.
+func (dec *Decoder) SetMaxStringLen(n int64) {
+    dec.max_string_len = n
+}
+
+// Set the maximum number of bytes of input a single call to Decode() or
+// DecodeInto() will consume. Once it's exceeded, decoding stops with an
+// error, bounding the work done for hostile input made of many small values,
+// which SetMaxStringLen() can't catch. A value of 0 (the default) means no
+// limit.
+func (dec *Decoder) SetMaxInputBytes(n int64) {
+    dec.max_input_bytes = n
+}
+
+// Cause the Decoder to return integers and byte strings as RawScalar values
+// carrying their original encoding, for fidelity-critical uses like
+// archiving, where re-encoding must reproduce the input exactly. Dictionary
+// keys are still decoded as strings, so dictionaries are reproduced exactly
+// only if their keys are canonically encoded and sorted.
+func (dec *Decoder) PreserveRaw() {
+    dec.preserve_raw = true
+}
+
+// Cause the Decoder to return an error for any dictionary that repeats a key,
+// rather than keeping the last value. Unlike RequireSortedKeys(), keys may
+// be in any order.
+func (dec *Decoder) DisallowDuplicateKeys() {
+    dec.disallow_dups = true
+}
+
+// Cause the Decoder to return an error for any dictionary whose keys are not
+// in strictly increasing order, compared as raw byte strings. Out-of-order
+// (or duplicate) keys indicate a non-canonical or tampered encoding, which
+// matters wherever a hash of the encoding must be stable, e.g., info hashes.
+func (dec *Decoder) RequireSortedKeys() {
+    dec.require_sorted = true
+}
+
+// Set a function to be called with each value as it is decoded, e.g., for
+// normalizing or validating values without a second pass over the result.
+// The path holds the dictionary keys and list indices (in decimal) leading
+// to the value. Lists and dictionaries are passed to fn once all of their
+// elements have been decoded (and passed to fn themselves). Dictionary keys
+// are not passed to fn.
+//
+// The value returned by fn replaces v. An error returned by fn aborts the
+// decode. The path slice is reused, so copy it if it needs to be retained.
+func (dec *Decoder) SetValueHook(fn func(path []string,
+    v interface{}) (interface{}, error)) {
+
+    dec.value_hook = fn
+}
+
+// Pass the value v, found at the current path, through the value hook, if
+// one has been set.
+func (dec *Decoder) apply_value_hook(v interface{}) (interface{}, error) {
+    if dec.value_hook == nil {
+        return v, nil
+    }
+
+    new_v, err := dec.value_hook(dec.path, v)
+    if err != nil {
+        return nil, fmt.Errorf("value hook failed at %v near byte %d: %w",
+            dec.path, dec.r.Tell(), err)
+    }
+
+    return new_v, nil
+}
+
+// Report whether there is more input to decode. This allows iterating over a
+// stream of concatenated values, e.g.,
+//
+//     dec := bencode.NewDecoder(r)
+//     for dec.More() {
+//         v, err := dec.Decode()
+//         if err != nil {
+//             return err
+//         }
+//         // do something with v
+//     }
+//
+// Decode() returns io.EOF once the input is exhausted.
+func (dec *Decoder) More() bool {
+    if dec.peeked != nil {
+        return dec.peeked.err == nil
+    }
+
+    if dec.skip_string_reader() != nil {
+        return false
+    }
+
+    _, err := dec.r.Peek(1)
+    return err == nil
+}
+
+// Cause DecodeInto() to parse byte strings holding decimal integers, e.g.,
+// "100000", into integer map values. This handles producers that stringify
+// numbers. Without it, such values produce an error.
+func (dec *Decoder) AllowStringInts() {
+    dec.coercer.string_ints = true
+}
+
+// Cause the Decoder to return byte string values as a []byte instead of a
+// string, e.g., for binary data like piece hashes. Dictionary keys are still
+// returned as strings, since they are used as map keys.
+func (dec *Decoder) UseBytes() {
+    dec.use_bytes = true
+}
+
+// Cause DecodeInto() to match a dictionary key to a struct field
+// case-insensitively, as encoding/json does, when no key matches the field's
+// name exactly. Exact matches are always preferred, so a key is never used
+// for another field once it matches one field exactly.
+func (dec *Decoder) MatchKeysCaseInsensitive() {
+    dec.coercer.fold_keys = true
+}
+
+// Cause DecodeInto() to return an error when a dictionary being filled into
+// a struct has keys that don't match any of its fields, instead of ignoring
+// them. This only applies to structs, not maps.
+func (dec *Decoder) DisallowUnknownFields() {
+    dec.coercer.disallow_unknown = true
+}
+
+// Set a function that gives the dictionary key for a struct field that has
+// no tag name, e.g., to map "PublisherWebpage" to "publisher-webpage". Tag
+// names are used as-is. Use the same function with Encoder.SetKeyMapper() to
+// round-trip structs.
+func (dec *Decoder) SetKeyMapper(fn func(field_name string) string) {
+    dec.coercer.key_mapper = fn
+}
+
+// Cause Decode() to return an error if any data follows the top-level value,
+// instead of leaving it unread. This is intended for validating that the
+// input consists of exactly one value, so it should not be used when
+// decoding a stream of concatenated values.
+func (dec *Decoder) DisallowTrailingData() {
+    dec.disallow_trailing = true
+}
 
 // Decode the Bencode data from the Reader provided to NewDecoder()
 // and return the resulting data structure as an interface.
 func (dec *Decoder) Decode() (interface{}, error) {
+    dec.max_depth_seen = 0
+
+    if dec.max_input_bytes > 0 {
+        dec.r.limit_reads(uint64(dec.InputOffset()), dec.max_input_bytes)
+    }
+    v, err := dec.decode_value()
+    dec.r.limit_reads(0, 0)
+    if err != nil {
+        return nil, err
+    }
+
+    if dec.disallow_trailing {
+        if err := dec.check_eof(); err != nil {
+            return nil, err
+        }
+    }
+
+    return v, nil
+}
+
+// Decode the next Bencode value from the Reader provided to NewDecoder() and
+// store it in the value pointed to by v, coercing it as FillData() does.
+func (dec *Decoder) DecodeInto(v interface{}) error {
+    var data interface{}
+    var err error
+
+    if v != nil && type_contains(reflect.TypeOf(v), raw_dict_type,
+        map[reflect.Type]bool{}) {
+        data, err = dec.decode_with_raw_dicts()
+        defer func() { dec.coercer.raw_dicts = nil }()
+    } else {
+        data, err = dec.Decode()
+    }
+    if err != nil {
+        return err
+    }
+
+    return dec.coercer.fill_data(v, data)
+}
+
+// Return an error if there is any data left to be read.
+func (dec *Decoder) check_eof() error {
+    if dec.peeked != nil {
+        pos := dec.peeked.start
+        return syntax_error(pos, "unexpected trailing data after top-level " +
+            "value at byte %d", pos)
+    }
+
+    pos := dec.r.Tell()
+    b := []byte{'\n'}
+
+    _, err := dec.r.Read(b)
+    if err == io.EOF {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    return syntax_error(pos, "unexpected trailing data after top-level " +
+        "value at byte %d", pos)
+}
+
+func (dec *Decoder) decode_value() (interface{}, error) {
+    start := dec.InputOffset()
     token, err := dec.Token()
     if err != nil {
         return nil, err
     }
 
+    dec.path = dec.path[:0]
+
     switch token.(type) {
     case Delim:
         switch token.(Delim) {
         case 'l':
             l, err := dec.parse_list()
             if err != nil {
-                return nil, fmt.Errorf("error parsing list: %s", err)
+                return nil, fmt.Errorf("error parsing list: %w", err)
             }
-            return l, nil
+            return dec.apply_value_hook(l)
         case 'd':
             d, err := dec.parse_dict()
             if err != nil {
-                return nil, fmt.Errorf("error parsing dict: %s", err)
+                return nil, fmt.Errorf("error parsing dict: %w", err)
             }
-            return d, nil
-        default:
+            return dec.apply_value_hook(d)
         }
 
-    default:
-        return token, nil
+        // a bare 'e' that doesn't close a list or dictionary
+        return nil, syntax_error(uint64(start), "unexpected end of " +
+            "container at byte %d", start)
     }
 
-    return nil, nil
+    return dec.apply_value_hook(token)
 }
 
 func (dec *Decoder) parse_dict() (map[string]interface{}, error) {
-    l, err := dec.parse_list()
+    // the 'd' has already been consumed
+    start := dec.r.Tell() - 1
+
+    l, err := dec.parse_items(true)
     if err != nil {
         return nil, err
     }
 
     if (len(l) & 1) != 0 {
-        return nil, fmt.Errorf("odd number of elements in dict at byte %d",
-            dec.r.Tell())
+        return nil, syntax_error(dec.r.Tell(), "odd number of elements in " +
+            "dict at byte %d", dec.r.Tell())
     }
 
     d := make(map[string]interface{})
-    for len(l) > 0 {
+    prev_key := ""
+    for i := 0; len(l) > 0; i++ {
+        if raw, ok := l[0].(RawScalar); ok {
+            l[0] = raw.Value
+        }
+        if b, ok := l[0].([]byte); ok {
+            l[0] = string(b)
+        }
+
         k, ok := l[0].(string)
         if !ok {
             this_type := reflect.TypeOf(l[0])
             kind := this_type.Kind()
-            return nil, fmt.Errorf("invalid type for dictionary key (%q) at " +
-                "byte %d.  must be a string.", kind.String(), dec.r.Tell())
+            return nil, syntax_error(dec.r.Tell(), "invalid type for " +
+                "dictionary key (%q) at byte %d.  must be a string.",
+                kind.String(), dec.r.Tell())
+        }
+
+        // strings compare as raw bytes, so keys with NULs or high bytes
+        // are ordered the same way the Encoder sorts them
+        if dec.require_sorted && i > 0 && k <= prev_key {
+            return nil, syntax_error(dec.r.Tell(), "dictionary key %q is " +
+                "not sorted after key %q in dict ending at byte %d", k,
+                prev_key, dec.r.Tell())
+        }
+        prev_key = k
+
+        if _, ok := d[k]; ok && dec.disallow_dups {
+            return nil, syntax_error(dec.r.Tell(), "duplicate dictionary " +
+                "key %q in dict ending at byte %d", k, dec.r.Tell())
         }
+
         d[k] = l[1]
         l = l[2:]
     }
 
+    dec.record_dict_span(d, start)
+
     return d, nil
 }
 
 func (dec *Decoder) parse_list() ([]interface{}, error) {
+    return dec.parse_items(false)
+}
+
+// Parse the elements of a list, or the alternating keys and values of a
+// dictionary if is_dict is true, up to the closing 'e'.
+func (dec *Decoder) parse_items(is_dict bool) ([]interface{}, error) {
+    // dictionaries are parsed as lists as well, so this counts both
+    dec.depth++
+    defer func() { dec.depth-- }()
+
+    if dec.depth > dec.max_depth_seen {
+        dec.max_depth_seen = dec.depth
+    }
+
+    if dec.max_depth > 0 && dec.depth > dec.max_depth {
+        return nil, syntax_error(dec.r.Tell(), "exceeded maximum nesting " +
+            "depth of %d at byte %d", dec.max_depth, dec.r.Tell())
+    }
+
     l := make([]interface{}, 0, 0)
 
-    for token, err := dec.Token(); err == nil; token, err = dec.Token() {
+    for {
+        token, err := dec.Token()
+        if err != nil {
+            // the input can't end before the list or dictionary does
+            return nil, unexpected_eof(err)
+        }
+
+        if token == Delim('e') {
+            // end of list
+            return l, nil
+        }
+
+        is_key := is_dict && (len(l) & 1) == 0
+        if is_key && dec.skip_keys != nil && dec.skip_keys[key_string(token)] {
+            if err := dec.discard_value(); err != nil {
+                return nil, err
+            }
+            continue
+        }
+        if dec.value_hook != nil && !is_key {
+            dec.path = append(dec.path, item_path_elem(l, is_dict))
+        }
+
+        var v interface{}
         switch token.(type) {
         case Delim:
             switch token.(Delim) {
             case 'l':
-                this_list, err := dec.parse_list()
-                if err != nil {
-                    return nil, err
-                }
-                l = append(l, this_list)
+                v, err = dec.parse_list()
             case 'd':
-                this_dict, err := dec.parse_dict()
-                if err != nil {
-                    return nil, err
-                }
-                l = append(l, this_dict)
-            case 'e':
-                // end of list
-                return l, nil
+                v, err = dec.parse_dict()
             default:
-                return nil, fmt.Errorf("unrecognized token at byte %d",
-                    dec.r.Tell())
+                return nil, syntax_error(dec.r.Tell(),
+                    "unrecognized token at byte %d", dec.r.Tell())
+            }
+            if err != nil {
+                return nil, err
             }
 
         default:
-            l = append(l, token)
+            v = token
         }
+
+        if dec.value_hook != nil && !is_key {
+            v, err = dec.apply_value_hook(v)
+            dec.path = dec.path[:len(dec.path) - 1]
+            if err != nil {
+                return nil, err
+            }
+        }
+
+        l = append(l, v)
+    }
+}
+
+// Return the path element for the next item to be appended to l: its index
+// in a list, or the key preceding it in a dictionary.
+func item_path_elem(l []interface{}, is_dict bool) string {
+    if !is_dict {
+        return strconv.Itoa(len(l))
+    }
+
+    k := l[len(l) - 1]
+    if raw, ok := k.(RawScalar); ok {
+        k = raw.Value
+    }
+    if b, ok := k.([]byte); ok {
+        return string(b)
     }
 
-    return l, nil
+    return fmt.Sprint(k)
 }
 
 // Return the next Bencode token from the Reader provided to NewDecoder().
-// Return values are a Delim ('l', 'd', or 'e'), an int64, or a string.
+// Return values are a Delim ('l', 'd', or 'e'), an int64 (or a uint64 for
+// integers too large for an int64, or a Number if UseNumber() has been
+// called), or a string (a []byte if UseBytes() has been called). If
+// PreserveRaw() has been called, integers and strings are returned as a
+// RawScalar instead.
 //
 // You only need to worry about this if you want to handle decoding yourself.
 func (dec *Decoder) Token() (Token, error) {
+    if p := dec.peeked; p != nil {
+        dec.peeked = nil
+        return p.token, p.err
+    }
+
+    if err := dec.skip_string_reader(); err != nil {
+        return nil, err
+    }
+
+    if !dec.preserve_raw {
+        return dec.read_token()
+    }
+
+    dec.r.start_record()
+    token, err := dec.read_token()
+    raw := dec.r.stop_record()
+    if err != nil {
+        return nil, err
+    }
+
+    if _, ok := token.(Delim); ok {
+        return token, nil
+    }
+
+    return RawScalar{Value: token, Raw: raw}, nil
+}
+
+func (dec *Decoder) read_token() (Token, error) {
     r := dec.r
 
     b := []byte{'\n'}
@@ -838,8 +2476,7 @@ func (dec *Decoder) Token() (Token, error) {
     switch {
     case s == 'i':
         // integer
-        num, err := dec.get_int('e')
-        return num, err
+        return dec.get_integer('e')
     case s == 'l':
         // list
         return Delim('l'), nil
@@ -850,52 +2487,188 @@ func (dec *Decoder) Token() (Token, error) {
         return Delim('e'), nil
     case s >= '0' && s <= '9':
         r.UnreadByte()
+        if dec.use_bytes {
+            return dec.get_bytes()
+        }
         return dec.get_string()
     default:
-        return nil, fmt.Errorf("unexpected byte %q near byte %d",
-            s, r.Tell())
+        // report the offset of the byte itself, not of the byte after it
+        return nil, syntax_error(r.Tell() - 1, "unexpected byte %q (0x%02x) " +
+            "at byte %d", s, s, r.Tell() - 1)
+    }
+}
+
+// Read the length prefix of a byte string, up to and including the ':'.
+func (dec *Decoder) get_string_len() (int64, error) {
+    size, err := dec.get_int(':')
+    if errors.Is(err, strconv.ErrRange) {
+        return 0, syntax_error(dec.r.Tell(), "string length out of range " +
+            "at byte %d", dec.r.Tell())
+    }
+    if err != nil {
+        return 0, err
+    }
+    if size < 0 {
+        return 0, syntax_error(dec.r.Tell(), "negative length %d " +
+            "specified for string at byte %d", size, dec.r.Tell())
+    }
+    // check before the length is converted to an int, which may only be 32
+    // bits
+    if size > math.MaxInt {
+        return 0, syntax_error(dec.r.Tell(), "string length %d too large " +
+            "at byte %d", size, dec.r.Tell())
     }
 
-    return nil, nil
+    return size, nil
 }
 
 func (dec *Decoder) get_string() (string, error) {
-    size_64, err := dec.get_int(':')
+    if dec.interned != nil {
+        return dec.get_interned_string()
+    }
+
+    p, err := dec.get_bytes()
+
+    return string(p), err
+}
+
+// Read a byte string, returning its contents.
+func (dec *Decoder) get_bytes() ([]byte, error) {
+    size, err := dec.get_checked_string_len()
     if err != nil {
-        return "", err
+        return nil, err
     }
-    size := int(size_64)
-    if size < 0 {
-        return "", fmt.Errorf("negative length specified for string at byte %d",
+
+    return dec.get_string_contents(size, nil)
+}
+
+// Read the length prefix of a byte string, enforcing SetMaxStringLen().
+func (dec *Decoder) get_checked_string_len() (int64, error) {
+    size, err := dec.get_string_len()
+    if err != nil {
+        return 0, err
+    }
+    if dec.max_string_len > 0 && size > dec.max_string_len {
+        return 0, syntax_error(dec.r.Tell(), "string length %d exceeds " +
+            "maximum of %d at byte %d", size, dec.max_string_len,
             dec.r.Tell())
     }
 
-    p := make([]byte, size, size)
-    p_read := p[:]
-    amtread := 0
+    return size, nil
+}
 
-    r := dec.r
-    for n, err := r.Read(p_read); amtread < size; n, err = r.Read(p_read) {
-        amtread += n
+// Read the contents of a byte string of the given size, using buf if it's
+// large enough.
+func (dec *Decoder) get_string_contents(size_64 int64, buf []byte) ([]byte,
+    error) {
 
-        if err != nil {
-            if err == io.EOF {
-                break
-            }
-            return "", err
-        }
+    size := int(size_64)
+
+    // the contents start here
+    start := dec.r.Tell()
 
-        p_read = p_read[n:]
+    if size > max_string_prealloc {
+        return dec.get_bytes_chunked(size_64, start)
+    }
+
+    var p []byte
+    if cap(buf) >= size {
+        p = buf[:size]
+    } else {
+        p = make([]byte, size, size)
+    }
+
+    amtread, err := io.ReadFull(dec.r, p)
+    if err == io.EOF || err == io.ErrUnexpectedEOF {
+        return nil, dec.short_read_error(start, size_64, int64(amtread))
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error reading string starting at byte " +
+            "%d after %d of %d bytes: %w", start, amtread, size, err)
+    }
+
+    return p, nil
+}
+
+// Return a *SyntaxError, wrapping io.ErrUnexpectedEOF, for input that ended
+// after only amtread bytes of a byte string of the given size.
+func (dec *Decoder) short_read_error(start uint64, size, amtread int64) error {
+    return &SyntaxError{msg: fmt.Sprintf("short read while reading string " +
+        "starting at byte %d: expected %d bytes, got %d", start, size,
+        amtread), err: io.ErrUnexpectedEOF, Offset: int64(dec.r.Tell())}
+}
+
+// Byte strings longer than this aren't allocated in full up front, since
+// their length prefix may be a lie.
+const max_string_prealloc = 1 << 20
+
+// Read the contents of a long byte string of the given size, starting at
+// start, growing the buffer as the data arrives, so that input claiming a
+// huge string but ending early only costs as much memory as it has data.
+func (dec *Decoder) get_bytes_chunked(size int64, start uint64) ([]byte,
+    error) {
+
+    buf := bytes.NewBuffer(make([]byte, 0, max_string_prealloc))
+    amtread, err := io.CopyN(buf, dec.r, size)
+    if err != nil && err != io.EOF {
+        return nil, fmt.Errorf("error reading string starting at byte " +
+            "%d after %d of %d bytes: %w", start, amtread, size, err)
     }
 
     if amtread < size {
-        return "", fmt.Errorf("short read while reading string")
+        return nil, dec.short_read_error(start, size, amtread)
+    }
+
+    return buf.Bytes(), nil
+}
+
+// Read an integer terminated by end, returning an int64, or a uint64 if the
+// value is too large for an int64.
+func (dec *Decoder) get_integer(end byte) (Token, error) {
+    start := dec.r.Tell()
+    digits, err := dec.read_digits(end)
+    if err != nil {
+        return nil, err
+    }
+
+    if dec.use_number {
+        if dec.trim_number_zeros && len(digits) > 1 {
+            digits = strings.TrimLeft(digits, "0")
+            if digits == "" {
+                digits = "0"
+            }
+        }
+        if !valid_number(digits) {
+            return nil, syntax_error(start, "leading zero in integer %s " +
+                "at byte %d", digits, start)
+        }
+        return Number(digits), nil
     }
 
-    return string(p), nil
+    num, err := strconv.ParseInt(digits, 10, 64)
+    if errors.Is(err, strconv.ErrRange) && digits[0] != '-' {
+        u, err := strconv.ParseUint(digits, 10, 64)
+        return u, wrap_syntax_error(start, err)
+    }
+
+    return num, wrap_syntax_error(start, err)
 }
 
 func (dec *Decoder) get_int(end byte) (int64, error) {
+    start := dec.r.Tell()
+    digits, err := dec.read_digits(end)
+    if err != nil {
+        return 0, err
+    }
+
+    num, err := strconv.ParseInt(digits, 10, 64)
+
+    return num, wrap_syntax_error(start, err)
+}
+
+// Read the digits, with an optional leading minus sign, of an integer
+// terminated by end.
+func (dec *Decoder) read_digits(end byte) (string, error) {
     r := dec.r
     b := []byte{'\n'}
     digits := make([]byte, 0, 1)
@@ -903,24 +2676,44 @@ func (dec *Decoder) get_int(end byte) (int64, error) {
     for {
         _, err := r.Read(b)
         if err != nil {
-            return 0, err
+            return "", err
         }
 
         d := b[0]
+        // offset of d itself
+        pos := r.Tell() - 1
+
+        if d == '-' {
+            // a minus sign is only allowed as the first character
+            if len(digits) != 0 {
+                return "", syntax_error(pos, "unexpected '-' in " +
+                    "integer spec at byte %d", pos)
+            }
+            digits = append(digits, d)
+            continue
+        }
 
-        if (d >= '0' && d <= '9') || d == '-' {
+        if d >= '0' && d <= '9' {
+            if d == '0' && len(digits) == 1 && digits[0] == '-' {
+                return "", syntax_error(pos, "negative zero in " +
+                    "integer spec at byte %d", pos)
+            }
             digits = append(digits, d)
             continue
         }
 
         if d == end {
+            if len(digits) == 0 || (len(digits) == 1 && digits[0] == '-') {
+                return "", syntax_error(pos, "empty integer at byte %d",
+                    pos)
+            }
             // done
             break
         }
 
-        return 0, fmt.Errorf("unexpected byte %q in integer spec near byte %d",
-            d, r.Tell())
+        return "", syntax_error(pos, "unexpected byte %q in integer " +
+            "spec at byte %d", d, pos)
     }
 
-    return strconv.ParseInt(string(digits), 10, 64)
+    return string(digits), nil
 }
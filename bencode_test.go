@@ -1,10 +1,19 @@
 package bencode_test
 
 import (
+    "bufio"
+    "bytes"
     bencode "github.com/cuberat/go-bencode"
+    "errors"
     "fmt"
+    "io"
+    "math"
     "reflect"
+    "runtime"
+    "strings"
     "testing"
+    "testing/iotest"
+    "time"
 )
 
 type TestItem struct {
@@ -52,6 +61,2600 @@ func TestEncode (t *testing.T) {
     }
 }
 
+func TestDecodeInvalid(t *testing.T) {
+    test_data := []string{
+        "i-0e",
+        "i1-2e",
+        "i--3e",
+    }
+
+    for idx, encoded := range test_data {
+        name := fmt.Sprintf("%d - %s", idx, encoded)
+        t.Run(name, func(st *testing.T) {
+            got, err := bencode.DecodeString(encoded)
+            if err == nil {
+                st.Errorf("expected error decoding %q, got %v", encoded, got)
+            }
+        })
+    }
+}
+
+func TestDecodeNegativeInt(t *testing.T) {
+    got, err := bencode.DecodeString("i-3e")
+    if err != nil {
+        t.Fatalf("error decoding string: %s", err)
+    }
+
+    if got != int64(-3) {
+        t.Errorf("got %v, expected -3", got)
+    }
+}
+
+func TestDecodeErrorMessage(t *testing.T) {
+    _, err := bencode.DecodeString("x")
+    if err == nil {
+        t.Fatalf("expected error decoding invalid input")
+    }
+
+    msg := err.Error()
+    if msg != "unexpected byte 'x' (0x78) at byte 0" {
+        t.Errorf("unexpected error message: %s", msg)
+    }
+
+    if strings.Contains(msg, "%!") {
+        t.Errorf("badly formatted error message: %s", msg)
+    }
+
+    // the offset is that of the offending byte, which is quoted, with its
+    // code, even when it isn't printable, and skipping a value reports it
+    // the same way
+    expected := "unexpected byte '\\x00' (0x00) at byte 4"
+    _, err = bencode.DecodeString("li1e\x00e")
+    if err == nil || !strings.HasSuffix(err.Error(), expected) {
+        t.Errorf("got error %v, expected %q", err, expected)
+    }
+
+    dec := bencode.NewDecoder(strings.NewReader("d1:ali1e\x00ee"))
+    dec.SkipKeys("a")
+    _, err = dec.Decode()
+    expected = "unexpected byte '\\x00' (0x00) at byte 8"
+    if err == nil || !strings.HasSuffix(err.Error(), expected) {
+        t.Errorf("got error %v skipping a value, expected %q", err, expected)
+    }
+}
+
+func TestFillDataFieldLimits(t *testing.T) {
+    type Limited struct {
+        Name string `bencode:"name,maxlen=4"`
+        Tags []string `bencode:"tags,maxitems=2"`
+    }
+
+    data, err := bencode.DecodeString("d4:name4:spam4:tagsl1:a1:bee")
+    if err != nil {
+        t.Fatalf("error decoding string: %s", err)
+    }
+
+    var ok_val Limited
+    if err := bencode.FillData(&ok_val, data); err != nil {
+        t.Fatalf("unexpected error filling data: %s", err)
+    }
+    if ok_val.Name != "spam" || len(ok_val.Tags) != 2 {
+        t.Errorf("got %+v", ok_val)
+    }
+
+    tests := map[string]string{
+        "maxlen": "d4:name5:spamse",
+        "maxitems": "d4:tagsl1:a1:b1:cee",
+    }
+
+    for opt, encoded := range tests {
+        data, err := bencode.DecodeString(encoded)
+        if err != nil {
+            t.Fatalf("error decoding string: %s", err)
+        }
+
+        var val Limited
+        err = bencode.FillData(&val, data)
+        if err == nil || !strings.Contains(err.Error(), opt) {
+            t.Errorf("expected %s error, got %v", opt, err)
+        }
+    }
+}
+
+func TestEncodeRedact(t *testing.T) {
+    data := map[string]interface{}{
+        "announce": "http://tracker.example.com/announce",
+        "info": map[string]interface{}{
+            "name": "file.txt",
+            "passkey": "secret",
+        },
+    }
+
+    buf := new(bytes.Buffer)
+    enc := bencode.NewEncoder(buf)
+    enc.Redact("REDACTED", "passkey")
+
+    if err := enc.Encode(data); err != nil {
+        t.Fatalf("error encoding data: %s", err)
+    }
+
+    expected := "d8:announce35:http://tracker.example.com/announce" +
+        "4:infod4:name8:file.txt7:passkey8:REDACTEDee"
+    if got := buf.String(); got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+}
+
+func TestDecodeTrailingData(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("i42e"))
+    dec.DisallowTrailingData()
+
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("unexpected error decoding clean input: %s", err)
+    }
+    if got != int64(42) {
+        t.Errorf("got %v, expected 42", got)
+    }
+
+    dec = bencode.NewDecoder(strings.NewReader("i42ei99e"))
+    dec.DisallowTrailingData()
+
+    _, err = dec.Decode()
+    if err == nil {
+        t.Fatalf("expected error for trailing data")
+    }
+    if !strings.Contains(err.Error(), "at byte 4") {
+        t.Errorf("error does not contain offset of trailing data: %s", err)
+    }
+}
+
+func TestDecoderInputOffset(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("d3:fooi1ee4:spam"))
+
+    if off := dec.InputOffset(); off != 0 {
+        t.Errorf("got initial offset %d, expected 0", off)
+    }
+
+    expected := []int64{10, 16}
+    for _, exp := range expected {
+        if _, err := dec.Decode(); err != nil {
+            t.Fatalf("error decoding: %s", err)
+        }
+        if off := dec.InputOffset(); off != exp {
+            t.Errorf("got offset %d, expected %d", off, exp)
+        }
+    }
+}
+
+func TestDecodeIntoStringInts(t *testing.T) {
+    encoded := "d6:lengthi42e6:pieces6:100000e"
+
+    var lenient map[string]int64
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.AllowStringInts()
+    if err := dec.DecodeInto(&lenient); err != nil {
+        t.Fatalf("error decoding into map: %s", err)
+    }
+
+    expected := map[string]int64{"length": 42, "pieces": 100000}
+    if !reflect.DeepEqual(lenient, expected) {
+        t.Errorf("got %v, expected %v", lenient, expected)
+    }
+
+    var strict map[string]int64
+    dec = bencode.NewDecoder(strings.NewReader(encoded))
+    if err := dec.DecodeInto(&strict); err == nil {
+        t.Errorf("expected error decoding string value into int map, got %v",
+            strict)
+    }
+}
+
+func TestDecoderMore(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("i1ei2e3:abc"))
+
+    got := make([]interface{}, 0, 3)
+    for dec.More() {
+        v, err := dec.Decode()
+        if err != nil {
+            t.Fatalf("error decoding: %s", err)
+        }
+        got = append(got, v)
+    }
+
+    expected := []interface{}{int64(1), int64(2), "abc"}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %v, expected %v", got, expected)
+    }
+
+    if _, err := dec.Decode(); err != io.EOF {
+        t.Errorf("got error %v at end of input, expected io.EOF", err)
+    }
+}
+
+func TestDecodeMaxDepth(t *testing.T) {
+    // alternating dictionaries and lists, to an even depth
+    nested := func(depth int) string {
+        return strings.Repeat("d1:al", depth / 2) + "i0e" +
+            strings.Repeat("ee", depth / 2)
+    }
+
+    if _, err := bencode.DecodeString(nested(bencode.DefaultMaxDepth)); err != nil {
+        t.Errorf("unexpected error at maximum depth: %s", err)
+    }
+
+    _, err := bencode.DecodeString(nested(100000))
+    if err == nil || !strings.Contains(err.Error(), "maximum nesting depth") {
+        t.Errorf("expected nesting depth error, got %v", err)
+    }
+
+    dec := bencode.NewDecoder(strings.NewReader(nested(10)))
+    dec.SetMaxDepth(5)
+    if _, err := dec.Decode(); err == nil {
+        t.Errorf("expected nesting depth error with custom limit")
+    }
+}
+
+type FileInfo struct {
+    Length int64 `bencode:"length"`
+    Path []string `bencode:"path"`
+}
+
+type FilesInfo struct {
+    Files []FileInfo `bencode:"files"`
+}
+
+func TestFillDataNestedStructSlices(t *testing.T) {
+    data, err := bencode.DecodeString("d5:filesld6:lengthi10e4:pathl1:a1:bee" +
+        "d6:lengthi20e4:pathl1:ceeee")
+    if err != nil {
+        t.Fatalf("error decoding string: %s", err)
+    }
+
+    var got FilesInfo
+    if err := bencode.FillData(&got, data); err != nil {
+        t.Fatalf("error filling data: %s", err)
+    }
+
+    expected := FilesInfo{Files: []FileInfo{
+        {Length: 10, Path: []string{"a", "b"}},
+        {Length: 20, Path: []string{"c"}},
+    }}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %+v, expected %+v", got, expected)
+    }
+}
+
+func TestFillDataNestedStructSlicesError(t *testing.T) {
+    // Integers are deliberately coerced into string fields, so use a
+    // dictionary as the malformed path element.
+    data, err := bencode.DecodeString("d5:filesld6:lengthi10e4:pathl1:aee" +
+        "d6:lengthi20e4:pathl1:bdeeeee")
+    if err != nil {
+        t.Fatalf("error decoding string: %s", err)
+    }
+
+    var got FilesInfo
+    err = bencode.FillData(&got, data)
+    if err == nil {
+        t.Fatalf("expected error filling data")
+    }
+
+    if !strings.Contains(err.Error(), "files[1].path[1]") {
+        t.Errorf("error does not name the path to the value: %s", err)
+    }
+
+    data, err = bencode.DecodeString("d5:filesld4:pathi1eeee")
+    if err != nil {
+        t.Fatalf("error decoding string: %s", err)
+    }
+
+    err = bencode.FillData(&got, data)
+    if err == nil || !strings.Contains(err.Error(), "files[0].path") {
+        t.Errorf("expected error naming files[0].path, got %v", err)
+    }
+}
+
+func TestDecodeMaxStringLen(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("999999999999:spam"))
+    dec.SetMaxStringLen(1 << 20)
+
+    _, err := dec.Decode()
+    if err == nil || !strings.Contains(err.Error(), "exceeds maximum") {
+        t.Errorf("expected string length error, got %v", err)
+    }
+
+    dec = bencode.NewDecoder(strings.NewReader("4:spam"))
+    dec.SetMaxStringLen(4)
+
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("unexpected error decoding: %s", err)
+    }
+    if got != "spam" {
+        t.Errorf("got %q, expected \"spam\"", got)
+    }
+}
+
+func TestDecodePreserveRaw(t *testing.T) {
+    encoded := "d3:agei007e4:listli0010e02:abe4:name04:spame"
+
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.PreserveRaw()
+
+    data, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    age := data.(map[string]interface{})["age"].(bencode.RawScalar)
+    if age.Value != int64(7) || string(age.Raw) != "i007e" {
+        t.Errorf("got %v (%q), expected 7 (\"i007e\")", age.Value, age.Raw)
+    }
+
+    got, err := bencode.EncodeToString(data)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    if got != encoded {
+        t.Errorf("got %q, expected %q", got, encoded)
+    }
+}
+
+func TestEncodeKeyHook(t *testing.T) {
+    data := map[string]interface{}{
+        "info": map[string]interface{}{
+            "name": "spam",
+            "files": []interface{}{
+                map[string]interface{}{"length": 1},
+            },
+        },
+        "announce": "url",
+    }
+
+    got := make([]string, 0, 5)
+    enc := bencode.NewEncoder(new(bytes.Buffer))
+    enc.SetKeyHook(func(path []string, key string) {
+        got = append(got, strings.Join(append(path, key), "/"))
+    })
+
+    if err := enc.Encode(data); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := []string{"announce", "info", "info/files", "info/files/0/length",
+        "info/name"}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %v, expected %v", got, expected)
+    }
+}
+
+func TestUnmarshalTyped(t *testing.T) {
+    data := []byte("d5:filesld6:lengthi10e4:pathl1:a1:beeee")
+
+    got, err := bencode.UnmarshalTyped[FilesInfo](data)
+    if err != nil {
+        t.Fatalf("error unmarshaling struct: %s", err)
+    }
+
+    expected := FilesInfo{Files: []FileInfo{{Length: 10,
+        Path: []string{"a", "b"}}}}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %+v, expected %+v", got, expected)
+    }
+
+    got_map, err := bencode.UnmarshalTyped[map[string]string](
+        []byte("d3:cow3:moo4:spam4:eggse"))
+    if err != nil {
+        t.Fatalf("error unmarshaling map: %s", err)
+    }
+
+    expected_map := map[string]string{"cow": "moo", "spam": "eggs"}
+    if !reflect.DeepEqual(got_map, expected_map) {
+        t.Errorf("got %v, expected %v", got_map, expected_map)
+    }
+}
+
+func TestDecodeRequireSortedKeys(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("d3:bari2e3:fooi1ee"))
+    dec.RequireSortedKeys()
+    if _, err := dec.Decode(); err != nil {
+        t.Errorf("unexpected error decoding sorted dict: %s", err)
+    }
+
+    for _, encoded := range []string{"d3:fooi1e3:bari2ee", "d3:fooi1e3:fooi2ee"} {
+        dec = bencode.NewDecoder(strings.NewReader(encoded))
+        dec.RequireSortedKeys()
+
+        _, err := dec.Decode()
+        if err == nil || !strings.Contains(err.Error(), "\"foo\"") {
+            t.Errorf("expected unsorted key error for %q, got %v", encoded, err)
+        }
+    }
+}
+
+func TestEncodeKeyByteOrder(t *testing.T) {
+    data := map[string]interface{}{
+        "\xff": 1,
+        "\xc3\xa9": 2, // "é" in UTF-8
+        "z": 3,
+        "A": 4,
+        "a": 5,
+    }
+
+    got, err := bencode.EncodeToString(data)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d1:Ai4e1:ai5e1:zi3e2:\xc3\xa9i2e1:\xffi1ee"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+}
+
+func TestDecoderMaxDepthSeen(t *testing.T) {
+    tests := map[string]int{
+        "i1e": 0,
+        "le": 1,
+        "d1:ald1:bi1eee1:cli1eee": 3,
+    }
+
+    for encoded, expected := range tests {
+        dec := bencode.NewDecoder(strings.NewReader(encoded))
+        if _, err := dec.Decode(); err != nil {
+            t.Fatalf("error decoding %q: %s", encoded, err)
+        }
+
+        if got := dec.MaxDepthSeen(); got != expected {
+            t.Errorf("got depth %d for %q, expected %d", got, encoded, expected)
+        }
+    }
+}
+
+type Color int
+
+func (c Color) String() string {
+    return [...]string{"red", "green", "blue"}[c]
+}
+
+func TestEncodeNonStringMapKeys(t *testing.T) {
+    got, err := bencode.EncodeToString(map[int]string{10: "a", 2: "b", -1: "c"})
+    if err != nil {
+        t.Fatalf("error encoding int keys: %s", err)
+    }
+
+    expected := "d2:-11:c2:101:a1:21:be"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+
+    got, err = bencode.EncodeToString(map[Color]int{0: 1, 1: 2, 2: 3})
+    if err != nil {
+        t.Fatalf("error encoding Stringer keys: %s", err)
+    }
+
+    expected = "d4:bluei3e5:greeni2e3:redi1ee"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+
+    _, err = bencode.EncodeToString(map[float64]int{1.5: 1})
+    if err == nil || !strings.Contains(err.Error(), "unsupported map key type") {
+        t.Errorf("expected unsupported key type error, got %v", err)
+    }
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+    type Floats struct {
+        F32 float32
+        F64 float64
+    }
+
+    tests := []Floats{
+        {F32: 3.1415927, F64: 3.14159265358979},
+        {F32: -0.1, F64: 1e-300},
+        {F32: 16777216, F64: 123456789012345680},
+    }
+
+    for _, item := range tests {
+        encoded, err := bencode.EncodeToString(item)
+        if err != nil {
+            t.Fatalf("error encoding: %s", err)
+        }
+
+        data, err := bencode.DecodeString(encoded)
+        if err != nil {
+            t.Fatalf("error decoding: %s", err)
+        }
+
+        var got Floats
+        if err := bencode.FillData(&got, data); err != nil {
+            t.Fatalf("error filling data: %s", err)
+        }
+
+        if got != item {
+            t.Errorf("got %+v from %q, expected %+v", got, encoded, item)
+        }
+    }
+}
+
+func TestBoolRoundTrip(t *testing.T) {
+    type Flags struct {
+        Private bool
+        Seeding bool
+    }
+
+    in := Flags{Private: true, Seeding: false}
+    encoded, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d7:Privatei1e7:Seedingi0ee"
+    if encoded != expected {
+        t.Errorf("got %q, expected %q", encoded, expected)
+    }
+
+    var got Flags
+    if err := bencode.Unmarshal([]byte(encoded), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if got != in {
+        t.Errorf("got %+v, expected %+v", got, in)
+    }
+
+    if err := bencode.Unmarshal([]byte("d7:Privatei42ee"), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if !got.Private {
+        t.Errorf("expected nonzero integer to decode as true")
+    }
+}
+
+func TestEncodeNil(t *testing.T) {
+    var nil_ptr *int
+    if _, err := bencode.EncodeToString(nil_ptr); !errors.Is(err, bencode.ErrEncodeNil) {
+        t.Errorf("got error %v for nil pointer, expected ErrEncodeNil", err)
+    }
+
+    if _, err := bencode.EncodeToString(nil); !errors.Is(err, bencode.ErrEncodeNil) {
+        t.Errorf("got error %v for nil interface, expected ErrEncodeNil", err)
+    }
+
+    var nil_map map[string]interface{}
+    got, err := bencode.EncodeToString(nil_map)
+    if err != nil {
+        t.Fatalf("error encoding nil map: %s", err)
+    }
+    if got != "de" {
+        t.Errorf("got %q for nil map, expected \"de\"", got)
+    }
+}
+
+func TestEncodeStructFieldNames(t *testing.T) {
+    type Torrent struct {
+        Name string `bencode:"name"`
+        Comment string
+        Secret string `bencode:"-"`
+        size int64
+    }
+
+    v := Torrent{Name: "spam", Comment: "eggs", Secret: "x", size: 7}
+    got, err := bencode.EncodeToString(v)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    // tagged fields use the tag name, untagged ones the field name, and
+    // unexported fields and fields tagged "-" are skipped
+    expected := "d7:Comment4:eggs4:name4:spame"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+
+    var decoded Torrent
+    if err := bencode.Unmarshal([]byte(got), &decoded); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if decoded != (Torrent{Name: "spam", Comment: "eggs"}) {
+        t.Errorf("got %#v after a round trip", decoded)
+    }
+}
+
+func TestEncodeNilStructField(t *testing.T) {
+    type Optional struct {
+        Name string `bencode:"name"`
+        Comment *string `bencode:"comment,omitempty"`
+    }
+
+    type Required struct {
+        Name string `bencode:"name"`
+        Comment *string `bencode:"comment"`
+    }
+
+    got, err := bencode.EncodeToString(Optional{Name: "spam"})
+    if err != nil {
+        t.Fatalf("error encoding omitempty nil field: %s", err)
+    }
+    if got != "d4:name4:spame" {
+        t.Errorf("got %q, expected \"d4:name4:spame\"", got)
+    }
+
+    comment := "eggs"
+    got, err = bencode.EncodeToString(Optional{Name: "spam", Comment: &comment})
+    if err != nil {
+        t.Fatalf("error encoding omitempty non-nil field: %s", err)
+    }
+    if got != "d7:comment4:eggs4:name4:spame" {
+        t.Errorf("got %q, expected \"d7:comment4:eggs4:name4:spame\"", got)
+    }
+
+    _, err = bencode.EncodeToString(Required{Name: "spam"})
+    if !errors.Is(err, bencode.ErrEncodeNil) {
+        t.Errorf("got error %v for required nil field, expected ErrEncodeNil",
+            err)
+    }
+}
+
+func TestEncodeDuplicateStrings(t *testing.T) {
+    large := strings.Repeat("x", 64)
+    data := map[string]interface{}{
+        "a": large,
+        "b": []interface{}{large, "small", "small", strings.Repeat("y", 64)},
+        "c": map[string]interface{}{"d": large},
+    }
+
+    enc := bencode.NewEncoder(new(bytes.Buffer))
+    enc.TrackDuplicates(32)
+    if err := enc.Encode(data); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := map[string]int{large: 3}
+    if got := enc.DuplicateStrings(); !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %v, expected %v", got, expected)
+    }
+}
+
+func TestLargeUintRoundTrip(t *testing.T) {
+    encoded, err := bencode.EncodeToString(uint64(math.MaxUint64))
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    if encoded != "i18446744073709551615e" {
+        t.Errorf("got %q, expected \"i18446744073709551615e\"", encoded)
+    }
+
+    got, err := bencode.DecodeString(encoded)
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if got != uint64(math.MaxUint64) {
+        t.Errorf("got %v (%T), expected uint64 %d", got, got,
+            uint64(math.MaxUint64))
+    }
+
+    got, err = bencode.DecodeString("i9223372036854775807e")
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if got != int64(math.MaxInt64) {
+        t.Errorf("got %v (%T), expected int64 %d", got, got,
+            int64(math.MaxInt64))
+    }
+
+    if _, err := bencode.DecodeString("i18446744073709551616e"); err == nil {
+        t.Errorf("expected error decoding integer too large for uint64")
+    }
+}
+
+type Level int8
+type Port uint16
+type Kind int64
+
+func TestNamedIntRoundTrip(t *testing.T) {
+    type Named struct {
+        Month time.Month
+        Level Level
+        Port Port
+        Kind Kind
+    }
+
+    in := Named{Month: time.December, Level: -3, Port: 6881, Kind: 1 << 40}
+    encoded, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d4:Kindi1099511627776e5:Leveli-3e5:Monthi12e4:Porti6881ee"
+    if encoded != expected {
+        t.Errorf("got %q, expected %q", encoded, expected)
+    }
+
+    var got Named
+    if err := bencode.Unmarshal([]byte(encoded), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if got != in {
+        t.Errorf("got %+v, expected %+v", got, in)
+    }
+}
+
+func TestDecodeBytes(t *testing.T) {
+    torrent := []byte("d8:announce14:http://tracker4:infod6:lengthi1024e" +
+        "4:name8:file.iso12:piece lengthi512eee")
+
+    got, err := bencode.DecodeBytes(torrent)
+    if err != nil {
+        t.Fatalf("error decoding bytes: %s", err)
+    }
+
+    expected := map[string]interface{}{
+        "announce": "http://tracker",
+        "info": map[string]interface{}{
+            "length": int64(1024),
+            "name": "file.iso",
+            "piece length": int64(512),
+        },
+    }
+
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+}
+
+func TestDecoderValueHook(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader(
+        "d4:name5:alice4:tagsl3:foo3:bare3:agei30ee"))
+
+    paths := []string{}
+    dec.SetValueHook(func(path []string, v interface{}) (interface{},
+        error) {
+
+        paths = append(paths, strings.Join(path, "/"))
+        if s, ok := v.(string); ok {
+            return strings.ToUpper(s), nil
+        }
+        return v, nil
+    })
+
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    expected := map[string]interface{}{
+        "age": int64(30),
+        "name": "ALICE",
+        "tags": []interface{}{"FOO", "BAR"},
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+
+    expected_paths := []string{"name", "tags/0", "tags/1", "tags", "age", ""}
+    if !reflect.DeepEqual(paths, expected_paths) {
+        t.Errorf("got paths %q, expected %q", paths, expected_paths)
+    }
+}
+
+func TestDecoderValueHookError(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("d4:listli1ei-2eee"))
+
+    hook_err := errors.New("negative value")
+    dec.SetValueHook(func(path []string, v interface{}) (interface{},
+        error) {
+
+        if i, ok := v.(int64); ok && i < 0 {
+            return nil, hook_err
+        }
+        return v, nil
+    })
+
+    _, err := dec.Decode()
+    if err == nil {
+        t.Fatalf("expected an error from the hook")
+    }
+    if !strings.Contains(err.Error(), "[list 1]") {
+        t.Errorf("error %q does not include the path", err)
+    }
+}
+
+func TestFillDataTypedMaps(t *testing.T) {
+    type Stats struct {
+        Counts map[string]int64 `bencode:"counts"`
+        Names map[string]string `bencode:"names"`
+        Groups map[string][]string `bencode:"groups"`
+    }
+
+    data, err := bencode.DecodeString("d6:countsd1:ai1e1:bi-2ee" +
+        "6:groupsd1:xl1:p1:qee5:namesd2:id3:abc4:sizei10eee")
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    var got Stats
+    if err := bencode.FillData(&got, data); err != nil {
+        t.Fatalf("error filling data: %s", err)
+    }
+
+    expected := Stats{
+        Counts: map[string]int64{"a": 1, "b": -2},
+        Names: map[string]string{"id": "abc", "size": "10"},
+        Groups: map[string][]string{"x": {"p", "q"}},
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+
+    var counts map[string]int64
+    err = bencode.FillData(&counts, map[string]interface{}{
+        "a": int64(1), "b": []interface{}{}})
+    if err == nil {
+        t.Errorf("expected an error filling a list into map[string]int64")
+    }
+}
+
+func TestFillDataPointerFields(t *testing.T) {
+    type Info struct {
+        Name string `bencode:"name"`
+        Length int64 `bencode:"length"`
+    }
+    type Torrent struct {
+        Announce string `bencode:"announce"`
+        Info *Info `bencode:"info"`
+        Comment *string `bencode:"comment"`
+    }
+
+    var with_info Torrent
+    err := bencode.Unmarshal([]byte("d8:announce3:url7:comment2:hi" +
+        "4:infod6:lengthi10e4:name1:aee"), &with_info)
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if with_info.Info == nil || *with_info.Info != (Info{"a", 10}) {
+        t.Errorf("got info %+v", with_info.Info)
+    }
+    if with_info.Comment == nil || *with_info.Comment != "hi" {
+        t.Errorf("got comment %v", with_info.Comment)
+    }
+
+    var without_info Torrent
+    err = bencode.Unmarshal([]byte("d8:announce3:urle"), &without_info)
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if without_info.Info != nil || without_info.Comment != nil {
+        t.Errorf("expected nil pointers, got %+v", without_info)
+    }
+}
+
+type EmbeddedBase struct {
+    ID int64 `bencode:"id"`
+    Name string `bencode:"name"`
+}
+
+type EmbeddedExtra struct {
+    Comment string `bencode:"comment"`
+}
+
+type EmbeddedNested struct {
+    Size int64 `bencode:"size"`
+}
+
+type EmbeddedOuter struct {
+    EmbeddedBase
+    *EmbeddedExtra
+    EmbeddedNested `bencode:"nested"`
+    // shadows EmbeddedBase.Name
+    Name string `bencode:"name"`
+    Kind string `bencode:"kind"`
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+    in := EmbeddedOuter{
+        EmbeddedBase: EmbeddedBase{ID: 7, Name: "hidden"},
+        EmbeddedExtra: &EmbeddedExtra{Comment: "hi"},
+        EmbeddedNested: EmbeddedNested{Size: 3},
+        Name: "outer",
+        Kind: "file",
+    }
+
+    encoded, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d7:comment2:hi2:idi7e4:kind4:file4:name5:outer" +
+        "6:nestedd4:sizei3eee"
+    if encoded != expected {
+        t.Errorf("got %q, expected %q", encoded, expected)
+    }
+
+    var got EmbeddedOuter
+    if err := bencode.Unmarshal([]byte(encoded), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    in.EmbeddedBase.Name = ""
+    if !reflect.DeepEqual(got, in) {
+        t.Errorf("got %+v, expected %+v", got, in)
+    }
+
+    // nil embedded pointers are skipped when encoding
+    in.EmbeddedExtra = nil
+    encoded, err = bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if strings.Contains(encoded, "comment") {
+        t.Errorf("got %q, expected no comment key", encoded)
+    }
+}
+
+func TestMatchKeysCaseInsensitive(t *testing.T) {
+    type Item struct {
+        Foo string
+        Bar string
+        Baz int64 `bencode:"baz"`
+    }
+
+    encoded := "d3:BAZi2e3:Bar1:b3:bar1:x3:foo1:fe"
+
+    var strict Item
+    if err := bencode.Unmarshal([]byte(encoded), &strict); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if strict != (Item{Bar: "b"}) {
+        t.Errorf("got %+v with case-sensitive matching", strict)
+    }
+
+    var folded Item
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.MatchKeysCaseInsensitive()
+    if err := dec.DecodeInto(&folded); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    // the exact match for Bar wins over "bar"
+    expected := Item{Foo: "f", Bar: "b", Baz: 2}
+    if folded != expected {
+        t.Errorf("got %+v, expected %+v", folded, expected)
+    }
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+    type Item struct {
+        Name string `bencode:"name"`
+        Tags map[string]int64 `bencode:"tags"`
+    }
+
+    encoded := "d4:name1:a4:nmae1:b4:tagsd1:xi1eee"
+
+    var lenient Item
+    if err := bencode.Unmarshal([]byte(encoded), &lenient); err != nil {
+        t.Errorf("unexpected error without DisallowUnknownFields: %s", err)
+    }
+
+    var strict Item
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.DisallowUnknownFields()
+    err := dec.DecodeInto(&strict)
+    if err == nil {
+        t.Fatalf("expected an error for the unknown key")
+    }
+    if !strings.Contains(err.Error(), `"nmae"`) {
+        t.Errorf("error %q doesn't name the unknown key", err)
+    }
+
+    // keys of map destinations are not fields
+    dec = bencode.NewDecoder(strings.NewReader("d4:name1:a4:tagsd1:xi1eee"))
+    dec.DisallowUnknownFields()
+    if err := dec.DecodeInto(&strict); err != nil {
+        t.Errorf("unexpected error: %s", err)
+    }
+}
+
+func TestDecoderReset(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("d1:ai1e1:bl1:xee"))
+    dec.UseNumber()
+
+    // leave data buffered that the reset must discard
+    if _, err := dec.Token(); err != nil {
+        t.Fatalf("error reading token: %s", err)
+    }
+
+    dec.Reset(strings.NewReader("li7ee"))
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding after reset: %s", err)
+    }
+
+    expected := []interface{}{bencode.Number("7")}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+    if dec.InputOffset() != 5 {
+        t.Errorf("got offset %d after reset, expected 5", dec.InputOffset())
+    }
+}
+
+func TestEncoderReset(t *testing.T) {
+    first := new(bytes.Buffer)
+    enc := bencode.NewEncoder(first)
+    enc.Redact("X", "secret")
+    enc.Encode(map[string]string{"secret": "a"})
+
+    second := new(bytes.Buffer)
+    enc.Reset(second)
+    if err := enc.Encode(map[string]string{"secret": "b"}); err != nil {
+        t.Fatalf("error encoding after reset: %s", err)
+    }
+
+    if first.String() != "d6:secret1:Xe" || second.String() != "d6:secret1:Xe" {
+        t.Errorf("got %q and %q", first.String(), second.String())
+    }
+}
+
+var bench_payload = []byte("d4:name5:alice3:agei30e4:tagsl1:a1:bee")
+
+func BenchmarkDecodeNewDecoder(b *testing.B) {
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        dec := bencode.NewDecoder(bytes.NewReader(bench_payload))
+        if _, err := dec.Decode(); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkDecodeReset(b *testing.B) {
+    r := bytes.NewReader(bench_payload)
+    dec := bencode.NewDecoder(r)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        r.Reset(bench_payload)
+        dec.Reset(r)
+        if _, err := dec.Decode(); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func TestMarshal(t *testing.T) {
+    data, err := bencode.Marshal(map[string]interface{}{"a": 1, "b": "x"})
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if string(data) != "d1:ai1e1:b1:xe" {
+        t.Errorf("got %q", data)
+    }
+
+    // the result must not be reused by later calls
+    if _, err := bencode.Marshal("zzzzzzzzzzzzzz"); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if string(data) != "d1:ai1e1:b1:xe" {
+        t.Errorf("result changed to %q", data)
+    }
+
+    if _, err := bencode.Marshal(nil); err == nil {
+        t.Errorf("expected an error encoding nil")
+    }
+}
+
+func TestEncodeToStringConcurrent(t *testing.T) {
+    done := make(chan error)
+    for g := 0; g < 8; g++ {
+        go func(g int) {
+            for i := 0; i < 500; i++ {
+                v := []interface{}{g, i, strings.Repeat("x", i % 50)}
+                expected := fmt.Sprintf("li%dei%de%d:%se", g, i, i % 50,
+                    strings.Repeat("x", i % 50))
+
+                got, err := bencode.EncodeToString(v)
+                if err == nil && got != expected {
+                    err = fmt.Errorf("got %q, expected %q", got, expected)
+                }
+                if err == nil {
+                    var data []byte
+                    data, err = bencode.Marshal(v)
+                    if err == nil && string(data) != expected {
+                        err = fmt.Errorf("got %q, expected %q", data,
+                            expected)
+                    }
+                }
+                if err != nil {
+                    done <- err
+                    return
+                }
+            }
+            done <- nil
+        }(g)
+    }
+
+    for g := 0; g < 8; g++ {
+        if err := <-done; err != nil {
+            t.Error(err)
+        }
+    }
+}
+
+var bench_announce = map[string]interface{}{
+    "complete": 10,
+    "incomplete": 3,
+    "interval": 1800,
+    "peers": "0123456789abcdefghij",
+}
+
+func BenchmarkEncodeToString(b *testing.B) {
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        if _, err := bencode.EncodeToString(bench_announce); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkEncodeUnpooled(b *testing.B) {
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        buf := new(bytes.Buffer)
+        if err := bencode.NewEncoder(buf).Encode(bench_announce); err != nil {
+            b.Fatal(err)
+        }
+        _ = buf.String()
+    }
+}
+
+// A typical torrent, decoded, as passed to the Encoder when re-encoding it.
+func decoded_torrent(t testing.TB) interface{} {
+    encoded := "d8:announce23:http://tracker/announce" +
+        "13:announce-listll23:http://tracker/announceel11:udp://other" +
+        "ee7:comment4:test10:created by5:bench13:creation datei1600000000e" +
+        "4:infod5:filesld6:lengthi1024e4:pathl3:dir5:a.binee" +
+        "d6:lengthi2048e4:pathl3:dir5:b.bineee" +
+        "4:name5:bench12:piece lengthi16384e6:pieces40:" +
+        strings.Repeat("0123456789", 4) + "ee"
+
+    data, err := bencode.DecodeString(encoded)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return data
+}
+
+// Named types that hide the concrete types of decoded values from the
+// Encoder's fast path, so that it has to use reflection.
+type reflect_str string
+type reflect_int int64
+type reflect_list []interface{}
+type reflect_dict map[string]interface{}
+
+func to_reflect_types(v interface{}) interface{} {
+    switch val := v.(type) {
+    case map[string]interface{}:
+        d := make(reflect_dict, len(val))
+        for k, elem := range val {
+            d[k] = to_reflect_types(elem)
+        }
+        return d
+    case []interface{}:
+        l := make(reflect_list, len(val))
+        for i, elem := range val {
+            l[i] = to_reflect_types(elem)
+        }
+        return l
+    case string:
+        return reflect_str(val)
+    case int64:
+        return reflect_int(val)
+    }
+
+    return v
+}
+
+func TestEncodeFastPathMatchesReflection(t *testing.T) {
+    data := decoded_torrent(t)
+
+    fast, err := bencode.EncodeToString(data)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    slow, err := bencode.EncodeToString(to_reflect_types(data))
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    if fast != slow {
+        t.Errorf("fast path produced %q, reflection produced %q", fast, slow)
+    }
+
+    for _, v := range []interface{}{int64(-5), int64(1 << 40), "", "abc"} {
+        fast, _ := bencode.EncodeToString(v)
+        slow, _ := bencode.EncodeToString(to_reflect_types(v))
+        if fast != slow {
+            t.Errorf("%v: fast path produced %q, reflection produced %q", v,
+                fast, slow)
+        }
+    }
+}
+
+func BenchmarkEncodeTorrentFast(b *testing.B) {
+    data := decoded_torrent(b)
+    enc := bencode.NewEncoder(io.Discard)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if err := enc.Encode(data); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkEncodeTorrentReflect(b *testing.B) {
+    data := to_reflect_types(decoded_torrent(b))
+    enc := bencode.NewEncoder(io.Discard)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if err := enc.Encode(data); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func TestEncodeByteSlice(t *testing.T) {
+    type Hash []byte
+
+    tests := map[string]interface{}{
+        "2:hi": []byte("hi"),
+        "0:": []byte{},
+        "3:\x00\x01\xff": Hash{0, 1, 0xff},
+        "li104ei105ee": []int{104, 105},
+    }
+
+    for expected, v := range tests {
+        got, err := bencode.EncodeToString(v)
+        if err != nil {
+            t.Errorf("error encoding %#v: %s", v, err)
+            continue
+        }
+        if got != expected {
+            t.Errorf("got %q, expected %q", got, expected)
+        }
+    }
+}
+
+func TestByteSliceFieldRoundTrip(t *testing.T) {
+    type Info struct {
+        Pieces []byte `bencode:"pieces"`
+    }
+
+    in := Info{Pieces: []byte{0xde, 0xad, 0xbe, 0xef, 0x00}}
+    encoded, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if encoded != "d6:pieces5:\xde\xad\xbe\xef\x00e" {
+        t.Errorf("got %q", encoded)
+    }
+
+    data, err := bencode.DecodeString(encoded)
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    var got Info
+    if err := bencode.FillData(&got, data); err != nil {
+        t.Fatalf("error filling data: %s", err)
+    }
+    if !bytes.Equal(got.Pieces, in.Pieces) {
+        t.Errorf("got %x, expected %x", got.Pieces, in.Pieces)
+    }
+}
+
+func TestFillByteSliceFromString(t *testing.T) {
+    type Hash []byte
+    var got struct {
+        Data []byte `bencode:"data"`
+        Hash Hash `bencode:"hash"`
+        Empty []byte `bencode:"empty"`
+    }
+
+    err := bencode.Unmarshal([]byte("d4:data4:spam5:empty0:4:hash2:\x00\xffe"),
+        &got)
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if !bytes.Equal(got.Data, []byte("spam")) {
+        t.Errorf("got %q, expected \"spam\"", got.Data)
+    }
+    if !bytes.Equal(got.Hash, Hash{0x00, 0xff}) {
+        t.Errorf("got %x, expected 00ff", got.Hash)
+    }
+    if got.Empty == nil || len(got.Empty) != 0 {
+        t.Errorf("got %#v, expected an empty slice", got.Empty)
+    }
+
+    var top []byte
+    if err := bencode.Unmarshal([]byte("4:spam"), &top); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if string(top) != "spam" {
+        t.Errorf("got %q, expected \"spam\"", top)
+    }
+}
+
+func TestByteArrayRoundTrip(t *testing.T) {
+    type Peer struct {
+        ID [20]byte `bencode:"peer id"`
+        Port int `bencode:"port"`
+    }
+
+    in := Peer{Port: 6881}
+    copy(in.ID[:], "-GB0001-\x00\x01\x02\x03abcdefgh")
+
+    encoded, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d7:peer id20:" + string(in.ID[:]) + "4:porti6881ee"
+    if encoded != expected {
+        t.Errorf("got %q, expected %q", encoded, expected)
+    }
+
+    var got Peer
+    if err := bencode.Unmarshal([]byte(encoded), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if got != in {
+        t.Errorf("got %+v, expected %+v", got, in)
+    }
+
+    err = bencode.Unmarshal([]byte("d7:peer id3:abce"), &got)
+    if err == nil {
+        t.Errorf("expected an error for a byte string of the wrong length")
+    }
+}
+
+func TestFillDataIntOverflow(t *testing.T) {
+    type Small struct {
+        I8 int8 `bencode:"i8"`
+        U16 uint16 `bencode:"u16"`
+        U uint `bencode:"u"`
+    }
+
+    var ok_val Small
+    err := bencode.Unmarshal([]byte("d2:i8i100e3:u16i65535e1:ui0ee"), &ok_val)
+    if err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if ok_val != (Small{I8: 100, U16: 65535}) {
+        t.Errorf("got %+v", ok_val)
+    }
+
+    tests := []string{
+        "d2:i8i1000ee",
+        "d2:i8i-129ee",
+        "d3:u16i65536ee",
+        "d1:ui-1ee",
+        "d2:i8i18446744073709551615ee",
+    }
+
+    for _, encoded := range tests {
+        var got Small
+        err := bencode.Unmarshal([]byte(encoded), &got)
+        if err == nil {
+            t.Errorf("%s: expected an overflow error, got %+v", encoded, got)
+            continue
+        }
+
+        var coerce_err *bencode.CoerceError
+        if !errors.As(err, &coerce_err) {
+            t.Errorf("%s: got %v, expected a *CoerceError", encoded, err)
+        }
+    }
+
+    // stringified integers are checked as well
+    dec := bencode.NewDecoder(strings.NewReader("d1:ai300ee"))
+    var m map[string]int8
+    if err := dec.DecodeInto(&m); err == nil {
+        t.Errorf("expected an overflow error, got %v", m)
+    }
+    dec = bencode.NewDecoder(strings.NewReader("d1:a3:300e"))
+    dec.AllowStringInts()
+    if err := dec.DecodeInto(&m); err == nil {
+        t.Errorf("expected an overflow error, got %v", m)
+    }
+}
+
+func TestTruncatedString(t *testing.T) {
+    tests := map[string]string{
+        "5:abc": "string starting at byte 2: expected 5 bytes, got 3",
+        "3:": "string starting at byte 2: expected 3 bytes, got 0",
+        "li1e10:abcdefgh": "string starting at byte 7: expected 10 bytes, " +
+            "got 8",
+    }
+
+    for encoded, expected := range tests {
+        dec := bencode.NewDecoder(strings.NewReader(encoded))
+
+        var err error
+        for err == nil {
+            _, err = dec.Token()
+        }
+
+        if !strings.Contains(err.Error(), expected) {
+            t.Errorf("%q: got error %q, expected it to contain %q", encoded,
+                err, expected)
+        }
+    }
+}
+
+func TestEmptyStringAtEnd(t *testing.T) {
+    got, err := bencode.DecodeString("0:")
+    if err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if got != "" {
+        t.Errorf("got %#v, expected an empty string", got)
+    }
+
+    got, err = bencode.DecodeString("l0:e")
+    if err != nil || !reflect.DeepEqual(got, []interface{}{""}) {
+        t.Errorf("got %#v, %v", got, err)
+    }
+}
+
+func TestInvalidStringLength(t *testing.T) {
+    tests := map[string]string{
+        // string lengths can't start with a sign at all
+        "-1:x": "unexpected byte '-' (0x2d) at byte 0",
+        "99999999999999999999:x": "string length out of range at byte 21",
+    }
+
+    for encoded, expected := range tests {
+        _, err := bencode.DecodeString(encoded)
+        if err == nil || err.Error() != expected {
+            t.Errorf("%q: got error %v, expected %q", encoded, err, expected)
+        }
+    }
+
+    // a length that overflows a 32-bit int is rejected by the limit before
+    // anything is allocated
+    dec := bencode.NewDecoder(strings.NewReader("4294967296:x"))
+    dec.SetMaxStringLen(1 << 20)
+    if _, err := dec.Decode(); err == nil {
+        t.Errorf("expected an error for a string length of 4294967296")
+    }
+}
+
+func TestEmptyInteger(t *testing.T) {
+    tests := map[string]string{
+        "ie": "empty integer at byte 1",
+        "i-e": "empty integer at byte 2",
+        "li1eiee": "empty integer at byte 5",
+        // string lengths must start with a digit
+        ":": "unexpected byte ':' (0x3a) at byte 0",
+    }
+
+    for encoded, expected := range tests {
+        for _, use_number := range []bool{false, true} {
+            dec := bencode.NewDecoder(strings.NewReader(encoded))
+            if use_number {
+                dec.UseNumber()
+            }
+
+            var err error
+            for err == nil {
+                _, err = dec.Token()
+            }
+
+            if err.Error() != expected {
+                t.Errorf("%q: got error %q, expected %q", encoded, err,
+                    expected)
+            }
+        }
+    }
+}
+
+func TestDecoderUseBytes(t *testing.T) {
+    encoded := "d4:hash4:\x00\xff\x00\x014:listl2:a\x00ee"
+
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.UseBytes()
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    expected := map[string]interface{}{
+        "hash": []byte{0, 0xff, 0, 1},
+        "list": []interface{}{[]byte{'a', 0}},
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+
+    // the bytes re-encode as the same byte strings
+    reencoded, err := bencode.EncodeToString(got)
+    if err != nil || reencoded != encoded {
+        t.Errorf("got %q, %v, expected %q", reencoded, err, encoded)
+    }
+
+    // and can still fill string fields
+    type Item struct {
+        Hash string `bencode:"hash"`
+    }
+    dec = bencode.NewDecoder(strings.NewReader(encoded))
+    dec.UseBytes()
+    var item Item
+    if err := dec.DecodeInto(&item); err != nil || item.Hash != "\x00\xff\x00\x01" {
+        t.Errorf("got %q, %v", item.Hash, err)
+    }
+}
+
+func TestTruncatedContainers(t *testing.T) {
+    got, err := bencode.DecodeString("l4:spame")
+    if err != nil || !reflect.DeepEqual(got, []interface{}{"spam"}) {
+        t.Errorf("got %#v, %v", got, err)
+    }
+
+    for _, encoded := range []string{"l4:spam", "d3:foo", "d3:fooli1e", "l"} {
+        _, err := bencode.DecodeString(encoded)
+        if !errors.Is(err, io.ErrUnexpectedEOF) {
+            t.Errorf("%q: got error %v, expected %v", encoded, err,
+                io.ErrUnexpectedEOF)
+        }
+    }
+
+    // EOF between top-level values is not an error
+    dec := bencode.NewDecoder(strings.NewReader("i1e"))
+    if _, err := dec.Decode(); err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if _, err := dec.Decode(); err != io.EOF {
+        t.Errorf("got error %v, expected %v", err, io.EOF)
+    }
+}
+
+func TestEncodeN(t *testing.T) {
+    buf := new(bytes.Buffer)
+    enc := bencode.NewEncoder(buf)
+
+    records := []interface{}{
+        map[string]interface{}{"name": "a", "size": 10, "tags": []string{"x"}},
+        "hello",
+        int64(-42),
+    }
+
+    var total int64
+    for _, rec := range records {
+        start := buf.Len()
+        n, err := enc.EncodeN(rec)
+        if err != nil {
+            t.Fatalf("error encoding %v: %s", rec, err)
+        }
+        if n != int64(buf.Len() - start) {
+            t.Errorf("%v: got count %d, wrote %d bytes", rec, n,
+                buf.Len() - start)
+        }
+        total += n
+    }
+
+    if total != int64(len("d4:name1:a4:sizei10e4:tagsl1:xee5:helloi-42e")) ||
+        total != int64(buf.Len()) {
+
+        t.Errorf("got total %d for %q", total, buf.String())
+    }
+
+    // the Encoder still writes to the same Writer afterwards
+    enc.Encode("z")
+    if !strings.HasSuffix(buf.String(), "1:z") {
+        t.Errorf("got %q", buf.String())
+    }
+
+    // an unbuffered Writer gets the data before EncodeN() returns
+    w := &slow_writer{}
+    var out bytes.Buffer
+    enc = bencode.NewEncoder(io.MultiWriter(w, &out))
+    for _, rec := range records {
+        start := out.Len()
+        n, err := enc.EncodeN(rec)
+        if err != nil {
+            t.Fatalf("error encoding %v: %s", rec, err)
+        }
+        if n == 0 || n != int64(out.Len() - start) {
+            t.Errorf("%v: got count %d, wrote %d bytes", rec, n,
+                out.Len() - start)
+        }
+    }
+
+    write_err := errors.New("disk full")
+    n, err := bencode.NewEncoder(&slow_writer{err: write_err}).EncodeN("hello")
+    if !errors.Is(err, write_err) || n != 0 {
+        t.Errorf("got count %d and error %v, expected 0 and the write error",
+            n, err)
+    }
+}
+
+func TestFillDataSliceOfStructs(t *testing.T) {
+    type Item struct {
+        Foo int64 `bencode:"foo"`
+    }
+
+    var got []Item
+    if err := bencode.Unmarshal([]byte("ld3:fooi1eed3:fooi2eee"), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    expected := []Item{{Foo: 1}, {Foo: 2}}
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %+v, expected %+v", got, expected)
+    }
+
+    // an empty list fills an empty, non-nil slice of the right type
+    type Holder struct {
+        Items []Item `bencode:"items"`
+    }
+    var holder Holder
+    if err := bencode.Unmarshal([]byte("d5:itemslee"), &holder); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if holder.Items == nil || len(holder.Items) != 0 {
+        t.Errorf("got %#v, expected an empty slice", holder.Items)
+    }
+}
+
+// Convert a Go field name like "PublisherWebpage" to "publisher-webpage".
+func kebab_case(name string) string {
+    var b strings.Builder
+    for i, r := range name {
+        if r >= 'A' && r <= 'Z' {
+            if i > 0 {
+                b.WriteByte('-')
+            }
+            r += 'a' - 'A'
+        }
+        b.WriteRune(r)
+    }
+
+    return b.String()
+}
+
+func TestKeyMapper(t *testing.T) {
+    type Meta struct {
+        Foo string
+        PublisherWebpage string
+        CreatedBy string `bencode:"created by"`
+    }
+
+    in := Meta{Foo: "x", PublisherWebpage: "http://p", CreatedBy: "me"}
+
+    buf := new(bytes.Buffer)
+    enc := bencode.NewEncoder(buf)
+    enc.SetKeyMapper(kebab_case)
+    if err := enc.Encode(in); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d10:created by2:me3:foo1:x17:publisher-webpage8:http://pe"
+    if buf.String() != expected {
+        t.Errorf("got %q, expected %q", buf.String(), expected)
+    }
+
+    var got Meta
+    dec := bencode.NewDecoder(buf)
+    dec.SetKeyMapper(kebab_case)
+    if err := dec.DecodeInto(&got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if got != in {
+        t.Errorf("got %+v, expected %+v", got, in)
+    }
+}
+
+type reflect_str_map map[string]reflect_str
+type reflect_int_map map[string]reflect_int
+
+func TestEncodeScalarMapsMatchReflection(t *testing.T) {
+    tests := map[string][]interface{}{
+        "d1:B1:x1:a3:one1:b3:two1:\xff0:e": {
+            map[string]string{"b": "two", "a": "one", "\xff": "", "B": "x"},
+            reflect_str_map{"b": "two", "a": "one", "\xff": "", "B": "x"},
+        },
+        "d1:ai1099511627776e1:mi0e1:zi-1ee": {
+            map[string]int64{"z": -1, "m": 0, "a": 1 << 40},
+            reflect_int_map{"z": -1, "m": 0, "a": 1 << 40},
+        },
+        "de": {map[string]string{}, reflect_str_map{}},
+    }
+
+    var buf bytes.Buffer
+    enc := bencode.NewEncoder(&buf)
+    enc.Redact("***", "key")
+    if err := enc.Encode(map[string]string{"key": "secret"}); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if buf.String() != "d3:key3:***e" {
+        t.Errorf("got %q, expected redacted value", buf.String())
+    }
+
+    for expected, values := range tests {
+        for _, v := range values {
+            got, err := bencode.EncodeToString(v)
+            if err != nil {
+                t.Fatalf("error encoding %T: %s", v, err)
+            }
+            if got != expected {
+                t.Errorf("%T: got %q, expected %q", v, got, expected)
+            }
+        }
+    }
+}
+
+func scalar_map_bench_data() map[string]string {
+    m := make(map[string]string, 1000)
+    for i := 0; i < 1000; i++ {
+        m[fmt.Sprintf("key-%04d", i)] = fmt.Sprintf("value %d", i)
+    }
+
+    return m
+}
+
+func BenchmarkEncodeStringMapFast(b *testing.B) {
+    data := scalar_map_bench_data()
+    enc := bencode.NewEncoder(io.Discard)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if err := enc.Encode(data); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkEncodeStringMapReflect(b *testing.B) {
+    data := make(reflect_str_map)
+    for k, v := range scalar_map_bench_data() {
+        data[k] = reflect_str(v)
+    }
+    enc := bencode.NewEncoder(io.Discard)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if err := enc.Encode(data); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func TestEncodePointerChains(t *testing.T) {
+    n := 42
+    p := &n
+    s := "spam"
+    m := map[string]interface{}{"a": &s, "b": &p}
+    var i interface{} = &m
+
+    tests := []struct {
+        v interface{}
+        expected string
+    }{
+        {&p, "i42e"},
+        {&s, "4:spam"},
+        {&m, "d1:a4:spam1:bi42ee"},
+        {&i, "d1:a4:spam1:bi42ee"},
+    }
+
+    for _, test := range tests {
+        got, err := bencode.EncodeToString(test.v)
+        if err != nil {
+            t.Errorf("%T: error encoding: %s", test.v, err)
+            continue
+        }
+        if got != test.expected {
+            t.Errorf("%T: got %q, expected %q", test.v, got, test.expected)
+        }
+    }
+
+    var nil_str *string
+    var nil_intfc interface{}
+    var nil_ptr_in_intfc interface{} = nil_str
+    for _, v := range []interface{}{nil_str, &nil_str, &nil_intfc,
+        &nil_ptr_in_intfc} {
+
+        if _, err := bencode.EncodeToString(v); !errors.Is(err,
+            bencode.ErrEncodeNil) {
+
+            t.Errorf("%T: got error %v, expected ErrEncodeNil", v, err)
+        }
+    }
+}
+
+func TestEncodeChan(t *testing.T) {
+    ch := make(chan int64)
+    go func() {
+        for _, n := range []int64{1, -2, 3} {
+            ch <- n
+        }
+        close(ch)
+    }()
+
+    got, err := bencode.EncodeToString(ch)
+    if err != nil {
+        t.Fatalf("error encoding channel: %s", err)
+    }
+    if got != "li1ei-2ei3ee" {
+        t.Errorf("got %q, expected \"li1ei-2ei3ee\"", got)
+    }
+
+    closed := make(chan string)
+    close(closed)
+    var recv_only <-chan string = closed
+    if got, err := bencode.EncodeToString(recv_only); err != nil || got != "le" {
+        t.Errorf("got %q, %v for closed channel, expected \"le\"", got, err)
+    }
+
+    var send_only chan<- string = make(chan string)
+    if _, err := bencode.EncodeToString(send_only); err == nil {
+        t.Errorf("expected error encoding send-only channel")
+    }
+}
+
+func TestDecoderMaxInputBytes(t *testing.T) {
+    data := "l" + strings.Repeat("i1e", 1000) + "e"
+
+    dec := bencode.NewDecoder(strings.NewReader(data))
+    dec.SetMaxInputBytes(100)
+    _, err := dec.Decode()
+    if err == nil {
+        t.Fatalf("expected error decoding input over the limit")
+    }
+    if !strings.Contains(err.Error(), "exceeded maximum input size") {
+        t.Errorf("got error %v, expected input size error", err)
+    }
+    if dec.InputOffset() > 100 {
+        t.Errorf("decoder consumed %d bytes, over the limit",
+            dec.InputOffset())
+    }
+
+    dec = bencode.NewDecoder(strings.NewReader("10:abcdefghij"))
+    dec.SetMaxInputBytes(8)
+    if _, err := dec.Decode(); err == nil {
+        t.Errorf("expected error decoding string over the limit")
+    }
+
+    // the limit applies to each value decoded, and may be met exactly
+    dec = bencode.NewDecoder(strings.NewReader(data + data))
+    dec.SetMaxInputBytes(int64(len(data)))
+    for i := 0; i < 2; i++ {
+        v, err := dec.Decode()
+        if err != nil {
+            t.Fatalf("error decoding input under the limit: %s", err)
+        }
+        if l, ok := v.([]interface{}); !ok || len(l) != 1000 {
+            t.Errorf("got %#v, expected a list of 1000 integers", v)
+        }
+    }
+}
+
+func TestExtraKeys(t *testing.T) {
+    type Torrent struct {
+        Announce string `bencode:"announce"`
+        Comment string `bencode:"comment,omitempty"`
+        Extra map[string]interface{} `bencode:",extra"`
+    }
+
+    data := "d8:announce3:url10:created by6:client4:infod4:name1:xe" +
+        "8:url-listl3:fooee"
+
+    var got Torrent
+    if err := bencode.Unmarshal([]byte(data), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    expected := Torrent{
+        Announce: "url",
+        Extra: map[string]interface{}{
+            "created by": "client",
+            "info": map[string]interface{}{"name": "x"},
+            "url-list": []interface{}{"foo"},
+        },
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+
+    encoded, err := bencode.EncodeToString(got)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if encoded != data {
+        t.Errorf("got %q, expected %q", encoded, data)
+    }
+
+    // fields take precedence over extra keys with the same name
+    got.Extra["announce"] = "other"
+    got.Comment = "hi"
+    encoded, err = bencode.EncodeToString(got)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    expected_enc := "d8:announce3:url7:comment2:hi10:created by6:client" +
+        "4:infod4:name1:xe8:url-listl3:fooee"
+    if encoded != expected_enc {
+        t.Errorf("got %q, expected %q", encoded, expected_enc)
+    }
+
+    // extra keys are captured rather than rejected
+    dec := bencode.NewDecoder(strings.NewReader(data))
+    dec.DisallowUnknownFields()
+    var strict Torrent
+    if err := dec.DecodeInto(&strict); err != nil {
+        t.Errorf("error decoding with unknown fields disallowed: %s", err)
+    }
+
+    type StringExtra struct {
+        A int64 `bencode:"a"`
+        Rest map[string]string `bencode:",extra"`
+    }
+    var typed StringExtra
+    if err := bencode.Unmarshal([]byte("d1:ai1e1:b1:xe"), &typed); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if typed.A != 1 || !reflect.DeepEqual(typed.Rest,
+        map[string]string{"b": "x"}) {
+
+        t.Errorf("got %#v", typed)
+    }
+}
+
+func TestFillDataIntToString(t *testing.T) {
+    tests := []struct {
+        in interface{}
+        expected string
+    }{
+        {int(-1), "-1"},
+        {int8(-128), "-128"},
+        {int16(-32768), "-32768"},
+        {int32(-2147483648), "-2147483648"},
+        {int64(-9223372036854775808), "-9223372036854775808"},
+        {uint(1), "1"},
+        {uint8(255), "255"},
+        {uint16(65535), "65535"},
+        {uint32(4294967295), "4294967295"},
+        {uint64(18446744073709551615), "18446744073709551615"},
+        {uint64(0), "0"},
+    }
+
+    for _, test := range tests {
+        var out struct {
+            S string `bencode:"s"`
+        }
+        in := map[string]interface{}{"s": test.in}
+        if err := bencode.FillData(&out, in); err != nil {
+            t.Errorf("%T: error filling string: %s", test.in, err)
+            continue
+        }
+        if out.S != test.expected {
+            t.Errorf("%T: got %q, expected %q", test.in, out.S, test.expected)
+        }
+    }
+}
+
+func TestFillDataInterfaceFields(t *testing.T) {
+    type Generic struct {
+        List []interface{} `bencode:"list"`
+        Dict map[string]interface{} `bencode:"dict"`
+        Any interface{} `bencode:"any"`
+        Empty []interface{} `bencode:"empty"`
+    }
+
+    data := "d3:anyli1ed1:ai2eee4:dictd1:ai1e1:bl1:xe1:cd1:di3eee" +
+        "5:emptyle4:listli1e2:hild1:ki2eeeee"
+
+    var got Generic
+    if err := bencode.Unmarshal([]byte(data), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    expected := Generic{
+        List: []interface{}{int64(1), "hi",
+            []interface{}{map[string]interface{}{"k": int64(2)}}},
+        Dict: map[string]interface{}{
+            "a": int64(1),
+            "b": []interface{}{"x"},
+            "c": map[string]interface{}{"d": int64(3)},
+        },
+        Any: []interface{}{int64(1),
+            map[string]interface{}{"a": int64(2)}},
+        Empty: []interface{}{},
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+
+    // nil values, which FillData() may be passed but the decoder never
+    // produces, leave zero values
+    in := map[string]interface{}{
+        "list": []interface{}{nil, "a"},
+        "dict": map[string]interface{}{"a": nil},
+        "any": nil,
+    }
+    got = Generic{}
+    if err := bencode.FillData(&got, in); err != nil {
+        t.Fatalf("error filling data: %s", err)
+    }
+    expected = Generic{
+        List: []interface{}{nil, "a"},
+        Dict: map[string]interface{}{"a": nil},
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %#v, expected %#v", got, expected)
+    }
+
+    var strs struct {
+        L []string `bencode:"l"`
+        M map[string]int64 `bencode:"m"`
+    }
+    in = map[string]interface{}{
+        "l": []interface{}{nil, "a"},
+        "m": map[string]interface{}{"x": nil},
+    }
+    if err := bencode.FillData(&strs, in); err != nil {
+        t.Fatalf("error filling data: %s", err)
+    }
+    if !reflect.DeepEqual(strs.L, []string{"", "a"}) ||
+        !reflect.DeepEqual(strs.M, map[string]int64{"x": 0}) {
+
+        t.Errorf("got %#v", strs)
+    }
+
+    var stringer struct {
+        S fmt.Stringer `bencode:"s"`
+    }
+    err := bencode.FillData(&stringer, map[string]interface{}{"s": "x"})
+    if err == nil {
+        t.Errorf("expected error filling non-empty interface")
+    }
+}
+
+func TestBinaryDictKeys(t *testing.T) {
+    data := "d0:i0e2:\x00\xffi3e1:ai1e2:a\x00i2e1:\x7fi4e1:\x80i5e" +
+        "1:\xffi6ee"
+
+    dec := bencode.NewDecoder(strings.NewReader(data))
+    dec.RequireSortedKeys()
+    v, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    d := v.(map[string]interface{})
+    if len(d) != 7 || d["\x00\xff"] != int64(3) || d["a\x00"] != int64(2) {
+        t.Errorf("got %#v", d)
+    }
+
+    encoded, err := bencode.EncodeToString(v)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if encoded != data {
+        t.Errorf("got %q, expected %q", encoded, data)
+    }
+
+    for _, unsorted := range []string{"d1:\x80i1e1:\x7fi2ee",
+        "d2:a\x00i1e1:ai2ee", "d2:\x00\xffi1e2:\x00\xffi2ee"} {
+
+        dec := bencode.NewDecoder(strings.NewReader(unsorted))
+        dec.RequireSortedKeys()
+        if _, err := dec.Decode(); err == nil {
+            t.Errorf("expected unsorted key error for %q", unsorted)
+        }
+    }
+}
+
+func TestDecodeLargeStrings(t *testing.T) {
+    const size = 3 << 20
+    contents := strings.Repeat("x", size)
+
+    v, err := bencode.DecodeString(fmt.Sprintf("%d:%s", size, contents))
+    if err != nil {
+        t.Fatalf("error decoding large string: %s", err)
+    }
+    if v != contents {
+        t.Errorf("large string decoded incorrectly")
+    }
+
+    // a huge claimed length with little data behind it
+    var before, after runtime.MemStats
+    runtime.ReadMemStats(&before)
+
+    data := fmt.Sprintf("%d:%s", int64(1) << 40, contents)
+    _, err = bencode.DecodeString(data)
+
+    runtime.ReadMemStats(&after)
+
+    var syntax_err *bencode.SyntaxError
+    if !errors.As(err, &syntax_err) {
+        t.Fatalf("got error %v, expected a *SyntaxError", err)
+    }
+    if !strings.Contains(err.Error(), "short read") ||
+        !strings.Contains(err.Error(), fmt.Sprintf("got %d", size)) {
+
+        t.Errorf("got error %q, expected a short read error", err)
+    }
+    if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64 << 20 {
+        t.Errorf("allocated %d bytes for a truncated string", alloc)
+    }
+
+    if _, err := bencode.DecodeString("5000000:abc"); err == nil ||
+        !strings.Contains(err.Error(), "expected 5000000 bytes, got 3") {
+
+        t.Errorf("got error %v for truncated string", err)
+    }
+}
+
+func TestEncodeInterfaceKeyedMap(t *testing.T) {
+    m := map[interface{}]interface{}{
+        "name": "spam",
+        int64(-3): "neg",
+        uint8(7): []interface{}{int64(1)},
+        "nested": map[interface{}]interface{}{10: "ten", "b": int64(2)},
+    }
+
+    got, err := bencode.EncodeToString(m)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    expected := "d2:-33:neg1:7li1ee4:name4:spam6:nestedd2:103:ten1:bi2eee"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+
+    bad := []map[interface{}]interface{}{
+        {1.5: "float"},
+        {nil: "nil"},
+        {[2]int{1, 2}: "array"},
+        {"1": "string", 1: "int"},
+    }
+    for _, m := range bad {
+        if _, err := bencode.EncodeToString(m); err == nil {
+            t.Errorf("expected error encoding %v", m)
+        }
+    }
+}
+
+func TestDecodeEmptyInput(t *testing.T) {
+    v, err := bencode.Decode(strings.NewReader(""))
+    if v != nil || err != nil {
+        t.Errorf("got %v, %v for empty input, expected nil, nil", v, err)
+    }
+    v, err = bencode.DecodeString("")
+    if v != nil || err != nil {
+        t.Errorf("got %v, %v for empty string, expected nil, nil", v, err)
+    }
+
+    v, err = bencode.DecodeNonEmpty(strings.NewReader(""))
+    if v != nil || !errors.Is(err, bencode.ErrEmptyInput) ||
+        !errors.Is(err, io.EOF) {
+
+        t.Errorf("got %v, %v for empty input, expected ErrEmptyInput", v, err)
+    }
+
+    v, err = bencode.DecodeNonEmpty(strings.NewReader("i5e"))
+    if v != int64(5) || err != nil {
+        t.Errorf("got %v, %v, expected 5", v, err)
+    }
+
+    _, err = bencode.DecodeNonEmpty(strings.NewReader("li5e"))
+    if err == nil || errors.Is(err, bencode.ErrEmptyInput) {
+        t.Errorf("got %v for truncated input, expected another error", err)
+    }
+}
+
+func TestDecodeBareEnd(t *testing.T) {
+    for _, data := range []string{"e", "ei1e"} {
+        v, err := bencode.DecodeString(data)
+        var syntax_err *bencode.SyntaxError
+        if !errors.As(err, &syntax_err) || syntax_err.Offset != 0 {
+            t.Errorf("%q: got %v, %v, expected a syntax error at byte 0",
+                data, v, err)
+        }
+    }
+
+    dec := bencode.NewDecoder(strings.NewReader("4:spame"))
+    v, err := dec.Decode()
+    if v != "spam" || err != nil {
+        t.Fatalf("got %v, %v, expected \"spam\"", v, err)
+    }
+    v, err = dec.Decode()
+    var syntax_err *bencode.SyntaxError
+    if !errors.As(err, &syntax_err) || syntax_err.Offset != 6 {
+        t.Errorf("got %v, %v, expected a syntax error at byte 6", v, err)
+    }
+
+    dec = bencode.NewDecoder(strings.NewReader("4:spame"))
+    dec.DisallowTrailingData()
+    if _, err := dec.Decode(); err == nil {
+        t.Errorf("expected trailing data error")
+    }
+
+    // a peeked 'e' is reported at its own offset
+    dec = bencode.NewDecoder(strings.NewReader("i1ee"))
+    dec.Decode()
+    dec.Peek()
+    _, err = dec.Decode()
+    if !errors.As(err, &syntax_err) || syntax_err.Offset != 3 {
+        t.Errorf("got %v, expected a syntax error at byte 3", err)
+    }
+}
+
+func TestFillArrayFromList(t *testing.T) {
+    var got struct {
+        Triple [3]int64 `bencode:"triple"`
+        Names [2]string `bencode:"names"`
+        Points [2][2]int `bencode:"points"`
+    }
+
+    data := "d5:namesl1:a1:be6:pointslli1ei2eeli3ei4eee6:tripleli1ei2ei3eee"
+    if err := bencode.Unmarshal([]byte(data), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if got.Triple != [3]int64{1, 2, 3} || got.Names != [2]string{"a", "b"} ||
+        got.Points != [2][2]int{{1, 2}, {3, 4}} {
+
+        t.Errorf("got %#v", got)
+    }
+
+    for _, bad := range []string{"d6:tripleli1ei2eee", "d6:tripleli1ei2ei3ei4eee",
+        "d6:tripleli1e1:xi3eee"} {
+
+        var v struct {
+            Triple [3]int64 `bencode:"triple"`
+        }
+        if err := bencode.Unmarshal([]byte(bad), &v); err == nil {
+            t.Errorf("expected error decoding %q", bad)
+        }
+    }
+
+    var short [3]int64
+    err := bencode.Unmarshal([]byte("li1ei2ee"), &short)
+    var coerce_err *bencode.CoerceError
+    if !errors.As(err, &coerce_err) {
+        t.Errorf("got error %v, expected a *CoerceError", err)
+    }
+}
+
+// Counts the calls to Write(), each of which takes a while, like a system
+// call on an unbuffered socket.
+type slow_writer struct {
+    writes int
+    err error
+}
+
+func (w *slow_writer) Write(p []byte) (int, error) {
+    w.writes++
+    if w.err != nil {
+        return 0, w.err
+    }
+    // spin rather than sleep, which can take much longer than asked
+    for start := time.Now(); time.Since(start) < time.Microsecond; {
+    }
+
+    return len(p), nil
+}
+
+func TestEncodeBuffered(t *testing.T) {
+    data := decoded_torrent(t)
+    w := &slow_writer{}
+    if err := bencode.NewEncoder(w).Encode(data); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if w.writes != 1 {
+        t.Errorf("got %d writes, expected 1", w.writes)
+    }
+
+    // a Writer that already buffers is neither wrapped nor flushed
+    var out strings.Builder
+    bw := bufio.NewWriter(&out)
+    if err := bencode.NewEncoder(bw).Encode(data); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if out.Len() != 0 {
+        t.Errorf("expected the bufio.Writer not to be flushed")
+    }
+    bw.Flush()
+    expected, _ := bencode.EncodeToString(data)
+    if out.String() != expected {
+        t.Errorf("got %q, expected %q", out.String(), expected)
+    }
+
+    write_err := errors.New("connection reset")
+    err := bencode.NewEncoder(&slow_writer{err: write_err}).Encode(data)
+    if !errors.Is(err, write_err) {
+        t.Errorf("got error %v, expected the error from flushing", err)
+    }
+}
+
+func BenchmarkEncodeSlowWriter(b *testing.B) {
+    list := make([]interface{}, 1000)
+    for i := range list {
+        list[i] = map[string]interface{}{"id": int64(i), "name": "item"}
+    }
+
+    run := func(b *testing.B, wrap func(w io.Writer) io.Writer) {
+        b.ReportAllocs()
+        for i := 0; i < b.N; i++ {
+            w := &slow_writer{}
+            if err := bencode.NewEncoder(wrap(w)).Encode(list); err != nil {
+                b.Fatal(err)
+            }
+            b.ReportMetric(float64(w.writes), "writes/op")
+        }
+    }
+
+    // a one-byte bufio.Writer is used as is, and passes every write through
+    b.Run("unbuffered", func(b *testing.B) {
+        run(b, func(w io.Writer) io.Writer {
+            return bufio.NewWriterSize(w, 1)
+        })
+    })
+    b.Run("buffered", func(b *testing.B) {
+        run(b, func(w io.Writer) io.Writer { return w })
+    })
+}
+
+func TestEncodeUnsupportedNested(t *testing.T) {
+    type file struct {
+        Path string `bencode:"path"`
+        Callback interface{} `bencode:"callback,omitempty"`
+    }
+    type info struct {
+        Files []file `bencode:"files"`
+    }
+
+    tests := map[string]struct {
+        v interface{}
+        path string
+    }{
+        "func in map": {map[string]interface{}{"info": map[string]interface{}{
+            "name": "x", "hook": func() {}}}, "info.hook"},
+        "chan in list": {map[string]interface{}{"list": []interface{}{int64(1),
+            make(chan<- int)}}, "list[1]"},
+        "struct field": {info{Files: []file{{Path: "a"}, {Path: "b",
+            Callback: func() {}}}}, "files[1].callback"},
+        "complex in reflected list": {[]reflect_list{{complex(1, 2)}},
+            "[0][0]"},
+    }
+
+    for name, test := range tests {
+        var err error
+        func() {
+            defer func() {
+                if r := recover(); r != nil {
+                    t.Errorf("%s: panicked: %v", name, r)
+                }
+            }()
+            _, err = bencode.EncodeToString(test.v)
+        }()
+
+        if err == nil {
+            t.Errorf("%s: expected an error", name)
+            continue
+        }
+        if !strings.Contains(err.Error(), " " + test.path + ":") {
+            t.Errorf("%s: error %q doesn't name the path %s", name, err,
+                test.path)
+        }
+        if !strings.Contains(err.Error(), "invalid data type") {
+            t.Errorf("%s: error %q doesn't name the problem", name, err)
+        }
+    }
+
+    // the underlying error is still available
+    _, err := bencode.EncodeToString([]interface{}{[]interface{}{nil}})
+    if !errors.Is(err, bencode.ErrEncodeNil) {
+        t.Errorf("got error %v, expected ErrEncodeNil", err)
+    }
+}
+
+func TestEncodeOmitNil(t *testing.T) {
+    type torrent struct {
+        Name string `bencode:"name,omitnil"`
+        Files []string `bencode:"files,omitnil"`
+        Tags []string `bencode:"tags,omitempty"`
+        Meta map[string]int64 `bencode:"meta,omitnil"`
+        Source *string `bencode:"source,omitnil"`
+    }
+
+    tests := map[string]struct {
+        v torrent
+        expected string
+    }{
+        "nil": {torrent{}, "d4:name0:e"},
+        "empty but not nil": {torrent{Files: []string{}, Tags: []string{},
+            Meta: map[string]int64{}}, "d5:filesle4:metade4:name0:e"},
+        "not empty": {torrent{Name: "x", Files: []string{"a"},
+            Tags: []string{"b"}, Meta: map[string]int64{"n": 1}},
+            "d5:filesl1:ae4:metad1:ni1ee4:name1:x4:tagsl1:bee"},
+    }
+
+    for name, test := range tests {
+        got, err := bencode.EncodeToString(test.v)
+        if err != nil {
+            t.Errorf("%s: error encoding: %s", name, err)
+            continue
+        }
+        if got != test.expected {
+            t.Errorf("%s: got %q, expected %q", name, got, test.expected)
+        }
+    }
+}
+
+func TestDecodeReaderError(t *testing.T) {
+    read_err := errors.New("connection reset")
+    data := "d4:listli1ei-22e3:abce3:numi42e4:skipl1:xe" +
+        "3:strd1:a5:helloee"
+    setups := map[string]func(dec *bencode.Decoder){
+        "default": func(dec *bencode.Decoder) {},
+        "bytes": func(dec *bencode.Decoder) { dec.UseBytes() },
+        "number": func(dec *bencode.Decoder) { dec.UseNumber() },
+        "interned": func(dec *bencode.Decoder) { dec.InternStrings() },
+        "skip keys": func(dec *bencode.Decoder) { dec.SkipKeys("skip") },
+    }
+
+    // fail after every possible prefix of the input
+    for n := 0; n < len(data); n++ {
+        failing := func() io.Reader {
+            return io.MultiReader(strings.NewReader(data[:n]),
+                iotest.ErrReader(read_err))
+        }
+
+        for name, setup := range setups {
+            dec := bencode.NewDecoder(failing())
+            setup(dec)
+            if _, err := dec.Decode(); !errors.Is(err, read_err) {
+                t.Errorf("%s: got error %v from Decode() after %d bytes",
+                    name, err, n)
+            }
+        }
+
+        if _, err := bencode.Decode(failing()); !errors.Is(err, read_err) {
+            t.Errorf("got error %v from package Decode() after %d bytes",
+                err, n)
+        }
+
+        var v map[string]interface{}
+        err := bencode.NewDecoder(failing()).DecodeInto(&v)
+        if !errors.Is(err, read_err) {
+            t.Errorf("got error %v from DecodeInto() after %d bytes", err, n)
+        }
+
+        dec := bencode.NewDecoder(failing())
+        for err = nil; err == nil; {
+            _, err = dec.Token()
+        }
+        if !errors.Is(err, read_err) {
+            t.Errorf("got error %v from Token() after %d bytes", err, n)
+        }
+
+        if err := bencode.Validate(failing()); !errors.Is(err, read_err) {
+            t.Errorf("got error %v from Validate() after %d bytes", err, n)
+        }
+    }
+
+    // strings too long to be read into a preallocated buffer
+    long := fmt.Sprintf("%d:", 4 << 20) + strings.Repeat("x", 2 << 20)
+    _, err := bencode.Decode(io.MultiReader(strings.NewReader(long),
+        iotest.ErrReader(read_err)))
+    if !errors.Is(err, read_err) {
+        t.Errorf("got error %v decoding a long string", err)
+    }
+}
+
+type extra_file struct {
+    Name string `bencode:"name"`
+    Pieces []string `bencode:"pieces"`
+}
+
+func (f extra_file) BencodeExtra() map[string]interface{} {
+    return map[string]interface{}{"num pieces": int64(len(f.Pieces))}
+}
+
+type extra_ptr_file struct {
+    Name string `bencode:"name"`
+    Size int64 `bencode:"size,omitempty"`
+    extra map[string]interface{}
+}
+
+func (f *extra_ptr_file) BencodeExtra() map[string]interface{} {
+    return f.extra
+}
+
+func TestEncodeBencodeExtra(t *testing.T) {
+    f := extra_file{Name: "a", Pieces: []string{"x", "y"}}
+    got, err := bencode.EncodeToString(f)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    // the computed key sorts between the fields
+    expected := "d4:name1:a10:num piecesi2e6:piecesl1:x1:yee"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+
+    // a method with a pointer receiver is found for values, too
+    p := extra_ptr_file{Name: "b", extra: map[string]interface{}{
+        "md5sum": "abc"}}
+    for _, v := range []interface{}{p, &p, []interface{}{p}} {
+        got, err := bencode.EncodeToString(v)
+        if err != nil {
+            t.Fatalf("error encoding %T: %s", v, err)
+        }
+        if !strings.Contains(got, "d6:md5sum3:abc4:name1:be") {
+            t.Errorf("got %q encoding %T", got, v)
+        }
+    }
+
+    // keys of fields collide even when the field is omitted
+    for _, key := range []string{"name", "size"} {
+        p.extra = map[string]interface{}{key: "x"}
+        if _, err := bencode.EncodeToString(p); err == nil {
+            t.Errorf("expected error for extra key %q colliding with a field",
+                key)
+        }
+    }
+}
+
+func TestDecodeOneByteReader(t *testing.T) {
+    long := strings.Repeat("0123456789", 1 << 17)
+    tests := map[string]interface{}{
+        "5:hello": "hello",
+        "0:": "",
+        "l3:abc4:defge": []interface{}{"abc", "defg"},
+        "d3:key5:valuee": map[string]interface{}{"key": "value"},
+        fmt.Sprintf("%d:%s", len(long), long): long,
+    }
+
+    for data, expected := range tests {
+        got, err := bencode.Decode(iotest.OneByteReader(strings.NewReader(data)))
+        if err != nil {
+            t.Errorf("error decoding %.20q: %s", data, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, expected) {
+            t.Errorf("got %.20q decoding %.20q", got, data)
+        }
+    }
+
+    for _, data := range []string{"5:hel", "5:", fmt.Sprintf("%d:%s",
+        len(long) + 1, long)} {
+
+        r := iotest.OneByteReader(strings.NewReader(data))
+        _, err := bencode.Decode(r)
+        var syntax_err *bencode.SyntaxError
+        if !errors.As(err, &syntax_err) ||
+            !errors.Is(err, io.ErrUnexpectedEOF) {
+
+            t.Errorf("got error %v decoding truncated %.20q", err, data)
+        }
+    }
+}
+
 func get_test_data() ([]*TestItem) {
     return []*TestItem{
         // Examples from https://en.wikipedia.org/wiki/Bencode
@@ -90,7 +2693,7 @@ func get_test_data() ([]*TestItem) {
         &TestItem{"d8:spam.mp3d6:author5:Alice6:lengthi100000eee",
             map[string]interface{}{
                 "spam.mp3": map[string]interface{}{
-                    "author":"alice", "length": "100000",
+                    "author":"Alice", "length": int64(100000),
                 },
             },
         },
@@ -0,0 +1,132 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "reflect"
+)
+
+// A BoolFormat selects the convention used to represent bools, since Bencode
+// has no boolean type.
+type BoolFormat int
+
+const (
+    // Integers: i1e for true and i0e for false. This is the default.
+    BoolInt BoolFormat = iota
+
+    // Byte strings: "true" and "false".
+    BoolString
+)
+
+// Set the convention used to encode bools.
+func (enc *Encoder) SetBoolFormat(format BoolFormat) {
+    enc.bool_format = format
+}
+
+// Set the convention used to decode bools with DecodeInto(). If strict is
+// false, values in either convention are accepted, and any nonzero integer
+// is true. If strict is true, only the values of the given convention are
+// accepted, i.e., i0e and i1e, or "false" and "true".
+func (dec *Decoder) SetBoolFormat(format BoolFormat, strict bool) {
+    dec.coercer.bool_format = format
+    dec.coercer.strict_bools = strict
+}
+
+func (enc *Encoder) encode_bool(b bool) error {
+    var s string
+    switch {
+    case enc.bool_format == BoolString && b:
+        s = "4:true"
+    case enc.bool_format == BoolString:
+        s = "5:false"
+    case b:
+        s = "i1e"
+    default:
+        s = "i0e"
+    }
+
+    _, err := enc.w.Write([]byte(s))
+
+    return err
+}
+
+func (c *coercer) set_val_coerce_to_bool(out *reflect.Value, in reflect.Value) error {
+    in_kind := in.Kind()
+
+    if is_signed, ok := get_int_kind(in_kind); ok {
+        if c.strict_bools && c.bool_format != BoolInt {
+            return coerce_error(in.Type(), out.Type(),
+                "integer %v doesn't match the %s bool format",
+                in.Interface(), c.bool_format)
+        }
+
+        var n uint64
+        if is_signed {
+            n = uint64(in.Int())
+        } else {
+            n = in.Uint()
+        }
+
+        if c.strict_bools && n > 1 {
+            return coerce_error(in.Type(), out.Type(),
+                "integer %v doesn't match the %s bool format",
+                in.Interface(), c.bool_format)
+        }
+
+        out.SetBool(n != 0)
+        return nil
+    }
+
+    if in_kind == reflect.String {
+        if c.strict_bools && c.bool_format != BoolString {
+            return coerce_error(in.Type(), out.Type(),
+                "string %q doesn't match the %s bool format",
+                in.String(), c.bool_format)
+        }
+
+        switch in.String() {
+        case "true":
+            out.SetBool(true)
+            return nil
+        case "false":
+            out.SetBool(false)
+            return nil
+        }
+
+        return coerce_error(in.Type(), out.Type(), "string %q is not a bool",
+            in.String())
+    }
+
+    return unsupported_coercion(out, in)
+}
+
+func (f BoolFormat) String() string {
+    if f == BoolString {
+        return "string"
+    }
+
+    return "integer"
+}
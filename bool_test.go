@@ -0,0 +1,61 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "strings"
+    "testing"
+)
+
+type Flags struct {
+    Private bool `bencode:"private"`
+}
+
+func TestBoolFormats(t *testing.T) {
+    tests := []struct {
+        format bencode.BoolFormat
+        encoded string
+        mismatched string
+    }{
+        {bencode.BoolInt, "d7:privatei1ee", "d7:private4:truee"},
+        {bencode.BoolString, "d7:private4:truee", "d7:privatei1ee"},
+    }
+
+    for _, test := range tests {
+        buf := new(bytes.Buffer)
+        enc := bencode.NewEncoder(buf)
+        enc.SetBoolFormat(test.format)
+
+        if err := enc.Encode(Flags{Private: true}); err != nil {
+            t.Fatalf("error encoding: %s", err)
+        }
+        if buf.String() != test.encoded {
+            t.Errorf("got %q for %s format, expected %q", buf.String(),
+                test.format, test.encoded)
+        }
+
+        for _, strict := range []bool{false, true} {
+            var got Flags
+            dec := bencode.NewDecoder(strings.NewReader(test.encoded))
+            dec.SetBoolFormat(test.format, strict)
+            if err := dec.DecodeInto(&got); err != nil {
+                t.Fatalf("error decoding %q: %s", test.encoded, err)
+            }
+            if !got.Private {
+                t.Errorf("got false decoding %q, expected true", test.encoded)
+            }
+
+            dec = bencode.NewDecoder(strings.NewReader(test.mismatched))
+            dec.SetBoolFormat(test.format, strict)
+            err := dec.DecodeInto(&got)
+            if strict && err == nil {
+                t.Errorf("expected error decoding %q in strict %s format",
+                    test.mismatched, test.format)
+            }
+            if !strict && err != nil {
+                t.Errorf("unexpected error decoding %q in lenient %s format: %s",
+                    test.mismatched, test.format, err)
+            }
+        }
+    }
+}
@@ -0,0 +1,99 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+)
+
+// Wrapped by the error returned by IsCanonical() when the input is
+// well-formed, but not in canonical form.
+var ErrNotCanonical = errors.New("not in canonical form")
+
+// Report whether data holds exactly one Bencode value in canonical form,
+// i.e., exactly the bytes the Encoder would produce when re-encoding the
+// decoded value: dictionary keys are unique and sorted as raw byte strings,
+// integers and string lengths have no leading zeros, and nothing follows the
+// value.
+//
+// If data is not canonical, false is returned along with a *SyntaxError
+// whose Offset is that of the first deviation found. The error wraps
+// ErrNotCanonical if data is otherwise well-formed.
+func IsCanonical(data []byte) (bool, error) {
+    dec := new_canonical_decoder(data)
+    if err := validate(dec, true); err != nil {
+        return false, err
+    }
+
+    return true, nil
+}
+
+// Create a Decoder for data that reads integers of any size as Numbers,
+// with any leading zeros removed, so that they can be re-encoded.
+func new_canonical_decoder(data []byte) *Decoder {
+    dec := NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+    dec.trim_number_zeros = true
+
+    return dec
+}
+
+// Check that the raw bytes of an integer or byte string starting at offset
+// are the same as its re-encoding.
+func check_canonical_scalar(raw RawScalar, offset uint64) error {
+    enc, err := Marshal(raw.Value)
+    if err != nil {
+        return err
+    }
+    if bytes.Equal(enc, raw.Raw) {
+        return nil
+    }
+
+    return &SyntaxError{msg: fmt.Sprintf("non-canonical encoding %q at " +
+        "byte %d, expected %q", raw.Raw, offset, enc), err: ErrNotCanonical,
+        Offset: int64(offset)}
+}
+
+// Return the canonical encoding of the single Bencode value in data, i.e.,
+// with dictionary keys sorted as raw byte strings and integers and string
+// lengths written without leading zeros. Byte strings are copied exactly,
+// whatever their contents. If a dictionary repeats a key, only the last
+// value is kept. An error is returned if data is malformed or has trailing
+// data.
+func Canonicalize(data []byte) ([]byte, error) {
+    dec := new_canonical_decoder(data)
+    dec.DisallowTrailingData()
+
+    v, err := dec.Decode()
+    if err != nil {
+        return nil, err
+    }
+
+    return Marshal(v)
+}
@@ -0,0 +1,102 @@
+package bencode_test
+
+import (
+    "errors"
+    bencode "github.com/cuberat/go-bencode"
+    "testing"
+)
+
+func TestIsCanonical(t *testing.T) {
+    for _, data := range []string{"i0e", "i-42e", "0:", "3:\xff\x00a", "le",
+        "de", "d1:ai1e1:bli2e3:fooee", "d1:Bi1e1:ai2ee",
+        "i18446744073709551615e", "i-99999999999999999999999e",
+        "li99999999999999999999999ee", test_info} {
+
+        ok, err := bencode.IsCanonical([]byte(data))
+        if err != nil || !ok {
+            t.Errorf("%q: got %v, %v, expected canonical", data, ok, err)
+        }
+    }
+
+    tests := map[string]int64{
+        "i03e": 0,
+        "i-0e": 0,
+        "03:abc": 0,
+        "li1ei03ee": 4,
+        "d1:bi1e1:ai2ee": 7,
+        "d1:ai1e1:ai2ee": 7,
+        "d1:a02:xye": 4,
+        "i1ei2e": 3,
+        "i099999999999999999999999e": 0,
+    }
+    for data, offset := range tests {
+        ok, err := bencode.IsCanonical([]byte(data))
+        if ok {
+            t.Errorf("%q: expected non-canonical", data)
+            continue
+        }
+
+        var syntax_err *bencode.SyntaxError
+        if !errors.As(err, &syntax_err) {
+            t.Errorf("%q: got error %v, expected a *SyntaxError", data, err)
+            continue
+        }
+        if syntax_err.Offset != offset {
+            t.Errorf("%q: got offset %d, expected %d (%s)", data,
+                syntax_err.Offset, offset, err)
+        }
+        if data != "i-0e" && !errors.Is(err, bencode.ErrNotCanonical) {
+            t.Errorf("%q: expected error %v to wrap ErrNotCanonical", data,
+                err)
+        }
+    }
+
+    ok, err := bencode.IsCanonical([]byte("l1:a"))
+    if ok || err == nil || errors.Is(err, bencode.ErrNotCanonical) {
+        t.Errorf("got %v, %v for truncated input", ok, err)
+    }
+}
+
+func TestCanonicalize(t *testing.T) {
+    tests := map[string]string{
+        "i42e": "i42e",
+        "i007e": "i7e",
+        "003:\xff\x00a": "3:\xff\x00a",
+        "d1:bi1e1:a0:e": "d1:a0:1:bi1ee",
+        "d1:\xffle1:ai1e1:Bi2ee": "d1:Bi2e1:ai1e1:\xfflee",
+        "ld1:zi1e1:yi2eei02ee": "ld1:yi2e1:zi1eei2ee",
+        "d1:ai1e1:ai2ee": "d1:ai2ee",
+        "i18446744073709551615e": "i18446744073709551615e",
+        "i99999999999999999999999e": "i99999999999999999999999e",
+        "i-99999999999999999999999e": "i-99999999999999999999999e",
+        "d1:bi0099999999999999999999999e1:ai00ee":
+            "d1:ai0e1:bi99999999999999999999999ee",
+    }
+
+    for data, expected := range tests {
+        got, err := bencode.Canonicalize([]byte(data))
+        if err != nil {
+            t.Errorf("%q: error canonicalizing: %s", data, err)
+            continue
+        }
+        if string(got) != expected {
+            t.Errorf("%q: got %q, expected %q", data, got, expected)
+        }
+
+        if ok, err := bencode.IsCanonical(got); !ok {
+            t.Errorf("%q: output %q is not canonical: %v", data, got, err)
+        }
+
+        again, err := bencode.Canonicalize(got)
+        if err != nil || string(again) != string(got) {
+            t.Errorf("%q: second pass produced %q, %v, expected %q", data,
+                again, err, got)
+        }
+    }
+
+    for _, data := range []string{"", "i1ei2e", "d1:ai1e", "i1x"} {
+        if _, err := bencode.Canonicalize([]byte(data)); err == nil {
+            t.Errorf("%q: expected error", data)
+        }
+    }
+}
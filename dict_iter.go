@@ -0,0 +1,102 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "fmt"
+    "sort"
+)
+
+// A DictIterator supplies the entries of a dictionary one at a time, e.g.,
+// from database rows or a channel. Next() returns ok == false once there are
+// no more entries.
+type DictIterator interface {
+    Next() (key string, value interface{}, ok bool)
+}
+
+// Tell the Encoder that EncodeIterator() will be given keys that are already
+// in canonical (byte-wise sorted) order, so that entries can be written as
+// they arrive instead of being buffered and sorted first. Keys that turn out
+// to be out of order or repeated cause EncodeIterator() to return an error,
+// after part of the dictionary has been written.
+func (enc *Encoder) AssumeSortedKeys() {
+    enc.presorted_keys = true
+}
+
+// Encode the entries produced by it as a dictionary. By default, the entries
+// are collected and their keys sorted so that the output is canonical. See
+// AssumeSortedKeys() to stream pre-sorted entries without holding them in
+// memory.
+func (enc *Encoder) EncodeIterator(it DictIterator) error {
+    if enc.presorted_keys {
+        return enc.flush(enc.encode_sorted_iterator(it))
+    }
+
+    vals := make(map[string]interface{})
+    keys := make([]string, 0)
+    for {
+        k, v, ok := it.Next()
+        if !ok {
+            break
+        }
+        if _, seen := vals[k]; seen {
+            return fmt.Errorf("duplicate dictionary key %q from iterator", k)
+        }
+        vals[k] = v
+        keys = append(keys, k)
+    }
+
+    sort.Strings(keys)
+
+    return enc.flush(enc.write_dict(keys, func(k string) interface{} {
+        return vals[k]
+    }))
+}
+
+func (enc *Encoder) encode_sorted_iterator(it DictIterator) error {
+    enc.w.Write([]byte{'d'})
+
+    var last string
+    for i := 0; ; i++ {
+        k, v, ok := it.Next()
+        if !ok {
+            break
+        }
+        if i > 0 && k <= last {
+            return fmt.Errorf("dictionary key %q from iterator is not " +
+                "after %q in sorted order", k, last)
+        }
+        last = k
+
+        if err := enc.write_dict_entry(k, v); err != nil {
+            return err
+        }
+    }
+
+    enc.w.Write([]byte{'e'})
+
+    return nil
+}
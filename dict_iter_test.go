@@ -0,0 +1,77 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "testing"
+)
+
+type mock_row struct {
+    key string
+    val interface{}
+}
+
+type mock_cursor struct {
+    rows []mock_row
+}
+
+func (c *mock_cursor) Next() (string, interface{}, bool) {
+    if len(c.rows) == 0 {
+        return "", nil, false
+    }
+    row := c.rows[0]
+    c.rows = c.rows[1:]
+
+    return row.key, row.val, true
+}
+
+func TestEncodeIterator(t *testing.T) {
+    cursor := &mock_cursor{rows: []mock_row{
+        {"name", "alice"},
+        {"age", 30},
+        {"tags", []string{"a", "b"}},
+    }}
+
+    buf := new(bytes.Buffer)
+    enc := bencode.NewEncoder(buf)
+    if err := enc.EncodeIterator(cursor); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d3:agei30e4:name5:alice4:tagsl1:a1:bee"
+    if buf.String() != expected {
+        t.Errorf("got %q, expected %q", buf.String(), expected)
+    }
+}
+
+func TestEncodeIteratorDuplicateKey(t *testing.T) {
+    cursor := &mock_cursor{rows: []mock_row{{"a", 1}, {"a", 2}}}
+
+    enc := bencode.NewEncoder(new(bytes.Buffer))
+    if err := enc.EncodeIterator(cursor); err == nil {
+        t.Errorf("expected an error for a duplicate key")
+    }
+}
+
+func TestEncodeIteratorPresorted(t *testing.T) {
+    cursor := &mock_cursor{rows: []mock_row{{"a", 1}, {"b", "x"}}}
+
+    buf := new(bytes.Buffer)
+    enc := bencode.NewEncoder(buf)
+    enc.AssumeSortedKeys()
+    if err := enc.EncodeIterator(cursor); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d1:ai1e1:b1:xe"
+    if buf.String() != expected {
+        t.Errorf("got %q, expected %q", buf.String(), expected)
+    }
+
+    cursor = &mock_cursor{rows: []mock_row{{"b", 1}, {"a", 2}}}
+    enc = bencode.NewEncoder(new(bytes.Buffer))
+    enc.AssumeSortedKeys()
+    if err := enc.EncodeIterator(cursor); err == nil {
+        t.Errorf("expected an error for keys out of order")
+    }
+}
@@ -0,0 +1,146 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "encoding/hex"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Write a human-readable rendering of v, a data structure as returned by
+// Decode(), to the Writer, w. Dictionaries are shown with their keys in
+// sorted order, one entry per line, and lists one element per line, each
+// indented by their depth. Byte strings are quoted if they are printable
+// UTF-8 and shown in hex otherwise, e.g., for the SHA-1 hashes in a
+// torrent's pieces, like
+//
+//     {
+//       "info": {
+//         "length": 10
+//         "pieces": <hex 3c6e0b8a...>
+//       }
+//     }
+//
+// This is meant for debugging, not as an interchange format.
+func Dump(v interface{}, w io.Writer) error {
+    d := &dumper{w: w}
+    d.dump_value(v, 0)
+    if d.err != nil {
+        return d.err
+    }
+
+    _, err := io.WriteString(w, "\n")
+
+    return err
+}
+
+type dumper struct {
+    w io.Writer
+    err error
+}
+
+func (d *dumper) print(format string, args ...interface{}) {
+    if d.err != nil {
+        return
+    }
+    _, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+func (d *dumper) dump_value(v interface{}, depth int) {
+    indent := strings.Repeat("  ", depth)
+
+    switch val := v.(type) {
+    case map[string]interface{}:
+        if len(val) == 0 {
+            d.print("{}")
+            return
+        }
+
+        keys := make([]string, 0, len(val))
+        for k := range val {
+            keys = append(keys, k)
+        }
+        sort.Strings(keys)
+
+        d.print("{\n")
+        for _, k := range keys {
+            d.print("%s  %s: ", indent, dump_string(k))
+            d.dump_value(val[k], depth + 1)
+            d.print("\n")
+        }
+        d.print("%s}", indent)
+
+    case []interface{}:
+        if len(val) == 0 {
+            d.print("[]")
+            return
+        }
+
+        d.print("[\n")
+        for _, elem := range val {
+            d.print("%s  ", indent)
+            d.dump_value(elem, depth + 1)
+            d.print("\n")
+        }
+        d.print("%s]", indent)
+
+    case string:
+        d.print("%s", dump_string(val))
+    case []byte:
+        d.print("%s", dump_string(string(val)))
+    case int64, uint64, Number:
+        d.print("%v", val)
+    case RawScalar:
+        d.dump_value(val.Value, depth)
+    default:
+        if d.err == nil {
+            d.err = fmt.Errorf("don't know how to dump type %T", v)
+        }
+    }
+}
+
+// Quote s if it is printable UTF-8, or render it in hex otherwise.
+func dump_string(s string) string {
+    if utf8.ValidString(s) {
+        printable := true
+        for _, r := range s {
+            if !strconv.IsPrint(r) {
+                printable = false
+                break
+            }
+        }
+        if printable {
+            return strconv.Quote(s)
+        }
+    }
+
+    return "<hex " + hex.EncodeToString([]byte(s)) + ">"
+}
@@ -0,0 +1,45 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "testing"
+)
+
+func TestDump(t *testing.T) {
+    data, err := bencode.DecodeString("d8:announce14:http://tracker" +
+        "4:infod6:lengthi10e4:name5:a.txt6:pieces4:\x3c\x6e\x0b\x8a" +
+        "e4:listli1ele1:xee")
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    buf := new(bytes.Buffer)
+    if err := bencode.Dump(data, buf); err != nil {
+        t.Fatalf("error dumping: %s", err)
+    }
+
+    expected := `{
+  "announce": "http://tracker"
+  "info": {
+    "length": 10
+    "name": "a.txt"
+    "pieces": <hex 3c6e0b8a>
+  }
+  "list": [
+    1
+    []
+    "x"
+  ]
+}
+`
+    if buf.String() != expected {
+        t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+    }
+}
+
+func TestDumpUnsupportedType(t *testing.T) {
+    if err := bencode.Dump(3.5, new(bytes.Buffer)); err == nil {
+        t.Errorf("expected an error dumping a float")
+    }
+}
@@ -0,0 +1,110 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "fmt"
+    "reflect"
+)
+
+// A SyntaxError describes malformed Bencode input.
+type SyntaxError struct {
+    msg string
+    // wrapped error, if any, e.g., from strconv
+    err error
+
+    // The offset in the input near which the problem was found.
+    Offset int64
+}
+
+func (e *SyntaxError) Error() string {
+    return e.msg
+}
+
+func (e *SyntaxError) Unwrap() error {
+    return e.err
+}
+
+// Return a *SyntaxError at the given offset, formatted as fmt.Errorf()
+// does.
+func syntax_error(offset uint64, format string, args ...interface{}) error {
+    return &SyntaxError{msg: fmt.Sprintf(format, args...),
+        Offset: int64(offset)}
+}
+
+// Wrap err, if not nil, in a *SyntaxError at the given offset, keeping its
+// message.
+func wrap_syntax_error(offset uint64, err error) error {
+    if err == nil {
+        return nil
+    }
+
+    return &SyntaxError{msg: err.Error(), err: err, Offset: int64(offset)}
+}
+
+// A CoerceError describes a decoded value that could not be stored in the
+// destination passed to FillData() or DecodeInto().
+type CoerceError struct {
+    msg string
+    // wrapped error, if any, e.g., from strconv
+    err error
+
+    // The type of the decoded value.
+    From reflect.Type
+
+    // The type it was to be stored as.
+    To reflect.Type
+}
+
+func (e *CoerceError) Error() string {
+    return e.msg
+}
+
+func (e *CoerceError) Unwrap() error {
+    return e.err
+}
+
+// Return a *CoerceError for coercing a value of type from to type to,
+// formatted as fmt.Errorf() does.
+func coerce_error(from, to reflect.Type, format string,
+    args ...interface{}) error {
+
+    return &CoerceError{msg: fmt.Sprintf(format, args...), From: from, To: to}
+}
+
+// Wrap err in a *CoerceError for storing in in out, keeping its message.
+func wrap_coerce_error(out *reflect.Value, in reflect.Value, err error) error {
+    return &CoerceError{msg: err.Error(), err: err, From: in.Type(),
+        To: out.Type()}
+}
+
+// Return the standard *CoerceError for a value, in, that can't be stored in
+// out.
+func unsupported_coercion(out *reflect.Value, in reflect.Value) error {
+    return coerce_error(in.Type(), out.Type(),
+        "don't know how to coerce %s to %s (%s to %s)", in.Kind(), out.Kind(),
+        in.Type(), out.Type())
+}
@@ -0,0 +1,120 @@
+package bencode_test
+
+import (
+    "errors"
+    bencode "github.com/cuberat/go-bencode"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestSyntaxErrorOffsets(t *testing.T) {
+    tests := []struct {
+        encoded string
+        offset int64
+    }{
+        {"q", 0},
+        {"i12x4e", 3},
+        {"i-0e", 2},
+        {"i--1e", 2},
+        {"i99999999999999999999e", 1},
+        {"-1:a", 0},
+        {"di1ei2ee", 8},
+        {"d1:bi1e1:ai2ee", 14},
+    }
+
+    for _, test := range tests {
+        dec := bencode.NewDecoder(strings.NewReader(test.encoded))
+        dec.RequireSortedKeys()
+        _, err := dec.Decode()
+
+        var syntax_err *bencode.SyntaxError
+        if !errors.As(err, &syntax_err) {
+            t.Errorf("%q: got error %v, expected a *SyntaxError",
+                test.encoded, err)
+            continue
+        }
+        if syntax_err.Offset != test.offset {
+            t.Errorf("%q: got offset %d, expected %d", test.encoded,
+                syntax_err.Offset, test.offset)
+        }
+    }
+}
+
+func TestSyntaxErrorTrailingData(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("i1ex"))
+    dec.DisallowTrailingData()
+    _, err := dec.Decode()
+
+    var syntax_err *bencode.SyntaxError
+    if !errors.As(err, &syntax_err) || syntax_err.Offset != 3 {
+        t.Errorf("got error %v, expected a *SyntaxError at offset 3", err)
+    }
+}
+
+func TestCoerceError(t *testing.T) {
+    type Item struct {
+        Count int64 `bencode:"count"`
+    }
+
+    var item Item
+    err := bencode.Unmarshal([]byte("d5:count3:tene"), &item)
+
+    var coerce_err *bencode.CoerceError
+    if !errors.As(err, &coerce_err) {
+        t.Fatalf("got error %v, expected a *CoerceError", err)
+    }
+    if coerce_err.From != reflect.TypeOf("") ||
+        coerce_err.To != reflect.TypeOf(int64(0)) {
+
+        t.Errorf("got types %s to %s", coerce_err.From, coerce_err.To)
+    }
+    if !strings.HasPrefix(err.Error(), "couldn't coerce count: ") {
+        t.Errorf("unexpected message %q", err)
+    }
+}
+
+func TestCoerceErrorKinds(t *testing.T) {
+    type File struct {
+        Name string `bencode:"name,maxlen=4"`
+        Tags []string `bencode:"tags,maxitems=1"`
+        Ratio float64 `bencode:"ratio"`
+    }
+    type Torrent struct {
+        Files []File `bencode:"files"`
+    }
+
+    tests := map[string]struct {
+        encoded string
+        prefix string
+    }{
+        "maxlen": {"d5:filesld4:name5:spamseee",
+            "couldn't coerce files[0].name: value for field name exceeds " +
+            "maxlen"},
+        "maxitems": {"d5:filesld4:tagsl1:a1:beeee",
+            "couldn't coerce files[0].tags: value for field tags exceeds " +
+            "maxitems"},
+        "unknown keys": {"d5:filesld4:name1:a4:sizei1eeee",
+            "couldn't coerce files[0]: unknown keys [\"size\"]"},
+        "float": {"d5:filesld5:ratio4:halfeee",
+            "couldn't coerce files[0].ratio: strconv.ParseFloat"},
+    }
+
+    for name, test := range tests {
+        dec := bencode.NewDecoder(strings.NewReader(test.encoded))
+        dec.DisallowUnknownFields()
+
+        var torrent Torrent
+        err := dec.DecodeInto(&torrent)
+
+        var coerce_err *bencode.CoerceError
+        if !errors.As(err, &coerce_err) {
+            t.Errorf("%s: got error %v, expected a *CoerceError", name, err)
+            continue
+        }
+        if !strings.HasPrefix(err.Error(), test.prefix) {
+            t.Errorf("%s: got message %q, expected it to start with %q", name,
+                err, test.prefix)
+        }
+    }
+}
@@ -0,0 +1,176 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "reflect"
+    "strings"
+)
+
+// A struct field that corresponds to a dictionary key, possibly promoted
+// from an embedded struct.
+type struct_field struct {
+    // index sequence for reflect.Value.FieldByIndex()
+    index []int
+    tag *field_tag
+    // whether the dictionary key was given in the tag
+    tagged bool
+}
+
+// Return the fields of the struct type t that correspond to dictionary keys,
+// in field order. As with encoding/json, the fields of embedded structs
+// without a tag name are promoted as though they were fields of t. When
+// several fields share a key, the least deeply nested one is used, or the
+// tagged one if there is a tie. Any remaining ambiguity causes all of them
+// to be ignored. If mapper is not nil, it gives the dictionary key for each
+// field without a tag name.
+func struct_fields(t reflect.Type,
+    mapper func(string) string) []*struct_field {
+
+    fields := make([]*struct_field, 0, t.NumField())
+    collect_struct_fields(t, nil, mapper, map[reflect.Type]bool{}, &fields)
+
+    by_name := make(map[string][]*struct_field, len(fields))
+    for _, f := range fields {
+        by_name[f.tag.name] = append(by_name[f.tag.name], f)
+    }
+
+    result := make([]*struct_field, 0, len(fields))
+    for _, f := range fields {
+        if dominant_field(by_name[f.tag.name]) == f {
+            result = append(result, f)
+        }
+    }
+
+    return result
+}
+
+func collect_struct_fields(t reflect.Type, index []int,
+    mapper func(string) string, seen map[reflect.Type]bool,
+    fields *[]*struct_field) {
+
+    seen[t] = true
+    defer delete(seen, t)
+
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        tag := parse_field_tag(f)
+        if tag.name == "-" {
+            continue
+        }
+
+        f_index := append(index[:len(index):len(index)], i)
+        tagged := strings.SplitN(f.Tag.Get("bencode"), ",", 2)[0] != ""
+
+        if f.Anonymous && !tagged {
+            ft := f.Type
+            if ft.Kind() == reflect.Ptr {
+                if f.PkgPath != "" {
+                    // can't allocate an unexported embedded pointer
+                    continue
+                }
+                ft = ft.Elem()
+            }
+            if ft.Kind() == reflect.Struct {
+                if !seen[ft] {
+                    collect_struct_fields(ft, f_index, mapper, seen, fields)
+                }
+                continue
+            }
+        }
+
+        if f.PkgPath != "" {
+            // unexported
+            continue
+        }
+
+        if !tagged && mapper != nil {
+            tag.name = mapper(f.Name)
+        }
+
+        *fields = append(*fields, &struct_field{index: f_index, tag: tag,
+            tagged: tagged})
+    }
+}
+
+// Return the field that should be used among those sharing a key, or nil if
+// it is ambiguous.
+func dominant_field(fields []*struct_field) *struct_field {
+    var best *struct_field
+    ambiguous := false
+
+    for _, f := range fields {
+        switch {
+        case best == nil || len(f.index) < len(best.index):
+            best = f
+            ambiguous = false
+        case len(f.index) > len(best.index):
+        case f.tagged == best.tagged:
+            ambiguous = true
+        case f.tagged:
+            best = f
+            ambiguous = false
+        }
+    }
+
+    if ambiguous {
+        return nil
+    }
+
+    return best
+}
+
+// Return the field of the struct v with the given index sequence, allocating
+// any nil embedded struct pointers along the way.
+func field_by_index_alloc(v reflect.Value, index []int) reflect.Value {
+    for i, x := range index {
+        if i > 0 && v.Kind() == reflect.Ptr {
+            if v.IsNil() {
+                v.Set(reflect.New(v.Type().Elem()))
+            }
+            v = v.Elem()
+        }
+        v = v.Field(x)
+    }
+
+    return v
+}
+
+// Return the field of the struct v with the given index sequence, or false
+// if it is inside a nil embedded struct pointer.
+func field_by_index(v reflect.Value, index []int) (reflect.Value, bool) {
+    for i, x := range index {
+        if i > 0 && v.Kind() == reflect.Ptr {
+            if v.IsNil() {
+                return reflect.Value{}, false
+            }
+            v = v.Elem()
+        }
+        v = v.Field(x)
+    }
+
+    return v, true
+}
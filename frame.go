@@ -0,0 +1,120 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+)
+
+// The number of bytes in the length prefix written by WriteFrame().
+const frame_header_len = 4
+
+// The default maximum length of the value in a frame read by ReadFrame().
+const DefaultMaxFrameLen = 16 << 20
+
+// Encode v and write it to w as a frame: the length of the encoded value as
+// a 4-byte big-endian integer, followed by the value itself. This allows
+// many messages to be sent over one stream, e.g., a TCP connection, and read
+// back with ReadFrame().
+func WriteFrame(w io.Writer, v interface{}) error {
+    buf, err := encode_pooled(v)
+    if err != nil {
+        return err
+    }
+    defer put_buffer(buf)
+
+    if uint64(buf.Len()) > math.MaxUint32 {
+        return fmt.Errorf("encoded value of %d bytes is too large for a " +
+            "frame", buf.Len())
+    }
+
+    var header [frame_header_len]byte
+    binary.BigEndian.PutUint32(header[:], uint32(buf.Len()))
+    if _, err := w.Write(header[:]); err != nil {
+        return err
+    }
+
+    _, err = w.Write(buf.Bytes())
+
+    return err
+}
+
+// Read a frame written by WriteFrame() from r and return its decoded value.
+// The frame must hold exactly one value. io.EOF is returned if r ends
+// cleanly before the next frame, and io.ErrUnexpectedEOF if it ends partway
+// through one. No more than the frame is read from r, so frames may be read
+// one after another from the same stream, even after one fails to decode.
+//
+// A frame longer than DefaultMaxFrameLen is an error. See ReadFrameLimit().
+func ReadFrame(r io.Reader) (interface{}, error) {
+    return ReadFrameLimit(r, DefaultMaxFrameLen)
+}
+
+// Read a frame from r, as ReadFrame() does, but allow values of up to
+// max_len bytes. A frame with a longer length prefix is an error, and
+// nothing beyond the prefix is read, so that a hostile peer can't cause an
+// unbounded amount to be read. The stream can't be resynchronized after
+// that, so it should be closed.
+func ReadFrameLimit(r io.Reader, max_len uint32) (interface{}, error) {
+    var header [frame_header_len]byte
+    if _, err := io.ReadFull(r, header[:]); err != nil {
+        return nil, err
+    }
+    size := binary.BigEndian.Uint32(header[:])
+    if size > max_len {
+        return nil, syntax_error(frame_header_len, "frame of %d bytes " +
+            "exceeds the maximum of %d", size, max_len)
+    }
+
+    lr := &io.LimitedReader{R: r, N: int64(size)}
+    dec := NewDecoder(lr)
+    dec.DisallowTrailingData()
+
+    v, err := dec.Decode()
+    if err == io.EOF {
+        if size == 0 {
+            err = syntax_error(frame_header_len, "empty frame")
+        } else {
+            err = io.ErrUnexpectedEOF
+        }
+    }
+    if err != nil {
+        // skip the rest of the frame, so the next one can be read
+        io.Copy(io.Discard, lr)
+        return nil, err
+    }
+
+    // the value was complete, but r ended before the frame did
+    if lr.N > 0 {
+        return nil, io.ErrUnexpectedEOF
+    }
+
+    return v, nil
+}
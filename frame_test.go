@@ -0,0 +1,147 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "errors"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/iotest"
+)
+
+func TestFrames(t *testing.T) {
+    messages := []interface{}{
+        map[string]interface{}{"msg_type": int64(0), "piece": int64(7)},
+        []interface{}{"spam", int64(-3)},
+        "",
+        int64(42),
+    }
+
+    r, w := io.Pipe()
+    go func() {
+        for _, m := range messages {
+            if err := bencode.WriteFrame(w, m); err != nil {
+                w.CloseWithError(err)
+                return
+            }
+        }
+        w.Close()
+    }()
+
+    for i, expected := range messages {
+        got, err := bencode.ReadFrame(r)
+        if err != nil {
+            t.Fatalf("error reading frame %d: %s", i, err)
+        }
+        if !reflect.DeepEqual(got, expected) {
+            t.Errorf("frame %d: got %#v, expected %#v", i, got, expected)
+        }
+    }
+
+    if _, err := bencode.ReadFrame(r); err != io.EOF {
+        t.Errorf("got error %v after the last frame, expected io.EOF", err)
+    }
+}
+
+func TestFrameFormat(t *testing.T) {
+    var buf bytes.Buffer
+    if err := bencode.WriteFrame(&buf, "spam"); err != nil {
+        t.Fatalf("error writing frame: %s", err)
+    }
+    if got := buf.String(); got != "\x00\x00\x00\x064:spam" {
+        t.Errorf("got frame %q", got)
+    }
+
+    if err := bencode.WriteFrame(&buf, nil); err == nil {
+        t.Errorf("expected error writing a nil value")
+    }
+}
+
+func TestReadFrameErrors(t *testing.T) {
+    tests := map[string]string{
+        "short header": "\x00\x00",
+        "short payload": "\x00\x00\x00\x064:sp",
+        "value longer than frame": "\x00\x00\x00\x034:spam",
+        "trailing data in frame": "\x00\x00\x00\x07i1ei2e\x00",
+        "empty frame": "\x00\x00\x00\x00",
+        "bad payload": "\x00\x00\x00\x02xx",
+    }
+
+    for name, data := range tests {
+        _, err := bencode.ReadFrame(bytes.NewReader([]byte(data)))
+        if err == nil || err == io.EOF {
+            t.Errorf("%s: got error %v", name, err)
+        }
+    }
+
+    truncated := map[string]string{
+        "header": "\x00\x00",
+        "payload after a complete value": "\x00\x00\x00\x0ai1e",
+        "payload after the header": "\x00\x00\x00\x0a",
+        "payload within a value": "\x00\x00\x00\x064:sp",
+    }
+    for name, data := range truncated {
+        _, err := bencode.ReadFrame(bytes.NewReader([]byte(data)))
+        if !errors.Is(err, io.ErrUnexpectedEOF) {
+            t.Errorf("%s: got error %v for a truncated frame", name, err)
+        }
+    }
+}
+
+func TestReadFrameAfterError(t *testing.T) {
+    // a bad integer near the start of a frame larger than the Decoder reads
+    // ahead
+    bad := "li1x" + strings.Repeat("0", 64 << 10) + "e"
+    long_frame := "\x00\x01\x00\x05" + bad
+
+    var buf bytes.Buffer
+    for _, frame := range []string{
+        long_frame,
+        "\x00\x00\x00\x07i1ei2e\x00", // trailing data
+        "\x00\x00\x00\x00", // empty
+    } {
+        buf.WriteString(frame)
+        if err := bencode.WriteFrame(&buf, "spam"); err != nil {
+            t.Fatalf("error writing frame: %s", err)
+        }
+    }
+
+    for i := 0; i < 3; i++ {
+        if _, err := bencode.ReadFrame(&buf); err == nil {
+            t.Fatalf("expected error reading corrupt frame %d", i)
+        }
+
+        got, err := bencode.ReadFrame(&buf)
+        if err != nil {
+            t.Fatalf("error reading frame after corrupt frame %d: %s", i, err)
+        }
+        if got != "spam" {
+            t.Errorf("got %#v after corrupt frame %d", got, i)
+        }
+    }
+}
+
+func TestReadFrameMaxLen(t *testing.T) {
+    // the length prefix alone is rejected, without reading the payload
+    r := io.MultiReader(bytes.NewReader([]byte("\xff\xff\xff\xff")),
+        iotest.ErrReader(errors.New("read past the header")))
+    _, err := bencode.ReadFrame(r)
+    if err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+        t.Errorf("got error %v for an oversized frame", err)
+    }
+
+    var buf bytes.Buffer
+    bencode.WriteFrame(&buf, "0123456789")
+    frame := buf.Bytes()
+    if _, err := bencode.ReadFrameLimit(bytes.NewReader(frame), 12);
+        err == nil {
+
+        t.Errorf("expected error for a frame longer than the limit")
+    }
+    got, err := bencode.ReadFrameLimit(bytes.NewReader(frame), 13)
+    if err != nil || got != "0123456789" {
+        t.Errorf("got %#v, %v for a frame within the limit", got, err)
+    }
+}
@@ -0,0 +1,110 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "bytes"
+    "testing"
+)
+
+// Inputs larger than this are skipped, since they only slow the fuzzer
+// down.
+const max_fuzz_len = 64 << 10
+
+// A struct with a mix of field types, for fuzzing the coercion of decoded
+// values.
+type fuzz_torrent struct {
+    Announce string `bencode:"announce"`
+    Info *struct {
+        Length int32 `bencode:"length"`
+        Name []byte `bencode:"name"`
+        Hash [4]byte `bencode:"hash"`
+        Private bool `bencode:"private"`
+        Files []map[string]uint8 `bencode:"files"`
+    } `bencode:"info"`
+    List []interface{} `bencode:"list"`
+    Ratio float64 `bencode:"ratio"`
+    Extra map[string]interface{} `bencode:",extra"`
+}
+
+func add_fuzz_seeds(f *testing.F) {
+    for _, item := range get_test_data() {
+        f.Add([]byte(item.Encoded))
+    }
+    for _, seed := range []string{"", "i-0e", "i01e", "-1:", "01:a", "le",
+        "d1:ai1e1:ai2ee", "d1:bi1e1:ai2ee", "i9223372036854775808e",
+        "i99999999999999999999999e", "99999999999999999999:", "l", "de",
+        "d1:a", "i1ei2e", test_info,
+        "d8:announce1:a4:infod5:filesld1:ai1eee4:hash4:abcd6:lengthi5e" +
+            "4:name1:x7:privatei1ee4:listli1ee5:ratio3:1.5e"} {
+
+        f.Add([]byte(seed))
+    }
+}
+
+// Decoding arbitrary input must fail cleanly rather than panic.
+func FuzzDecode(f *testing.F) {
+    add_fuzz_seeds(f)
+
+    f.Fuzz(func(t *testing.T, data []byte) {
+        if len(data) > max_fuzz_len {
+            t.Skip()
+        }
+
+        bencode.DecodeString(string(data))
+
+        dec := bencode.NewDecoder(bytes.NewReader(data))
+        dec.SetMaxStringLen(1 << 20)
+        for dec.More() {
+            if _, err := dec.Decode(); err != nil {
+                break
+            }
+        }
+
+        bencode.ValidateBytes(data)
+        bencode.IsCanonical(data)
+
+        var torrent fuzz_torrent
+        bencode.Unmarshal(data, &torrent)
+    })
+}
+
+// Input that decodes must re-encode to a canonical form that is stable
+// under a second round trip.
+func FuzzRoundTrip(f *testing.F) {
+    add_fuzz_seeds(f)
+
+    f.Fuzz(func(t *testing.T, data []byte) {
+        if len(data) > max_fuzz_len {
+            t.Skip()
+        }
+
+        dec := bencode.NewDecoder(bytes.NewReader(data))
+        dec.SetMaxStringLen(1 << 20)
+        dec.DisallowTrailingData()
+        v, err := dec.Decode()
+        if err != nil {
+            return
+        }
+
+        encoded, err := bencode.Marshal(v)
+        if err != nil {
+            t.Fatalf("error encoding decoded value %#v: %s", v, err)
+        }
+
+        if ok, err := bencode.IsCanonical(encoded); !ok {
+            t.Fatalf("encoding %q is not canonical: %s", encoded, err)
+        }
+
+        v2, err := bencode.DecodeBytes(encoded)
+        if err != nil {
+            t.Fatalf("error decoding %q: %s", encoded, err)
+        }
+        encoded2, err := bencode.Marshal(v2)
+        if err != nil {
+            t.Fatalf("error re-encoding: %s", err)
+        }
+        if !bytes.Equal(encoded, encoded2) {
+            t.Fatalf("round trip not stable: %q then %q", encoded, encoded2)
+        }
+    })
+}
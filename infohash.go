@@ -0,0 +1,151 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "bytes"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/subtle"
+    "fmt"
+    "hash"
+    "io"
+)
+
+// Report whether two torrents, a and b, have the same info hash, i.e.,
+// whether they describe the same content regardless of differences in other
+// metadata like trackers or comments. The SHA-1 hashes of the exact encoded
+// "info" dictionaries are compared in constant time.
+func SameInfoHash(a, b []byte) (bool, error) {
+    a_info, err := raw_info(bytes.NewReader(a))
+    if err != nil {
+        return false, err
+    }
+
+    b_info, err := raw_info(bytes.NewReader(b))
+    if err != nil {
+        return false, err
+    }
+
+    a_hash := sha1.Sum(a_info)
+    b_hash := sha1.Sum(b_info)
+
+    return subtle.ConstantTimeCompare(a_hash[:], b_hash[:]) == 1, nil
+}
+
+// Return the info hash of the torrent read from r: the SHA-1 hash of the exact
+// encoded bytes of its "info" dictionary, as found in the input, not of a
+// re-encoding. The rest of the top-level dictionary is skipped.
+func InfoHash(r io.Reader) ([20]byte, error) {
+    info, err := raw_info(r)
+    if err != nil {
+        return [20]byte{}, err
+    }
+
+    return sha1.Sum(info), nil
+}
+
+// Return the BitTorrent v2 info hash of the torrent read from r: the SHA-256
+// hash of the exact encoded bytes of its "info" dictionary.
+func InfoHashV2(r io.Reader) ([32]byte, error) {
+    info, err := raw_info(r)
+    if err != nil {
+        return [32]byte{}, err
+    }
+
+    return sha256.Sum256(info), nil
+}
+
+// Write the exact encoded bytes of the "info" dictionary of the torrent read
+// from r to each of the given hashes, e.g., to compute both the v1 (SHA-1)
+// and v2 (SHA-256) info hashes of a hybrid torrent in a single pass:
+//
+//     v1, v2 := sha1.New(), sha256.New()
+//     err := bencode.HashInfo(r, v1, v2)
+func HashInfo(r io.Reader, hashes ...hash.Hash) error {
+    info, err := raw_info(r)
+    if err != nil {
+        return err
+    }
+
+    for _, h := range hashes {
+        h.Write(info)
+    }
+
+    return nil
+}
+
+// Return the exact encoded bytes of the "info" dictionary in the torrent
+// read from r. The rest of the top-level dictionary is skipped.
+func raw_info(r io.Reader) ([]byte, error) {
+    dec := NewDecoder(r)
+
+    token, err := dec.Token()
+    if err != nil {
+        return nil, err
+    }
+    if token != Delim('d') {
+        return nil, fmt.Errorf("torrent is not a dictionary")
+    }
+
+    for {
+        token, err := dec.Token()
+        if err != nil {
+            return nil, unexpected_eof(err)
+        }
+        if token == Delim('e') {
+            break
+        }
+
+        key, ok := token.(string)
+        if !ok {
+            return nil, syntax_error(dec.r.Tell(), "invalid type for " +
+                "dictionary key at byte %d.  must be a string.", dec.r.Tell())
+        }
+
+        if key == "info" {
+            dec.r.start_record()
+            info, err := dec.decode_value()
+            raw := dec.r.stop_record()
+            if err != nil {
+                return nil, unexpected_eof(err)
+            }
+
+            if _, ok := info.(map[string]interface{}); !ok {
+                return nil, fmt.Errorf("torrent info is not a dictionary")
+            }
+
+            return raw, nil
+        }
+
+        // a bare 'e' where the value should be is an error
+        if err := dec.discard_value(); err != nil {
+            return nil, err
+        }
+    }
+
+    return nil, fmt.Errorf("torrent has no info dictionary")
+}
@@ -0,0 +1,137 @@
+package bencode_test
+
+import (
+    "crypto/sha1"
+    "crypto/sha256"
+    bencode "github.com/cuberat/go-bencode"
+    "encoding/hex"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+const test_info = "d6:lengthi1024e4:name8:file.txt12:piece lengthi16384e" +
+    "6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+
+func TestSameInfoHash(t *testing.T) {
+    a := []byte("d8:announce15:http://tracker14:info" + test_info + "e")
+    b := []byte("d8:announce15:http://tracker27:comment5:hello4:info" +
+        test_info + "e")
+    c := []byte("d8:announce15:http://tracker14:info" +
+        "d6:lengthi2048e4:name8:file.txt12:piece lengthi16384e" +
+        "6:pieces20:aaaaaaaaaaaaaaaaaaaaee")
+
+    same, err := bencode.SameInfoHash(a, b)
+    if err != nil {
+        t.Fatalf("error comparing info hashes: %s", err)
+    }
+    if !same {
+        t.Errorf("expected torrents with the same info to match")
+    }
+
+    same, err = bencode.SameInfoHash(a, c)
+    if err != nil {
+        t.Fatalf("error comparing info hashes: %s", err)
+    }
+    if same {
+        t.Errorf("expected torrents with different info not to match")
+    }
+
+    if _, err := bencode.SameInfoHash(a, []byte("d3:fooi1ee")); err == nil {
+        t.Errorf("expected error for torrent without info dictionary")
+    }
+}
+
+func TestInfoHash(t *testing.T) {
+    tests := map[string]string{
+        test_info: "5e73478c8951a47213df390eedca1a9e580e47cb",
+        // keys out of order: the original bytes are hashed, not a canonical
+        // re-encoding
+        "d4:name8:file.txt6:lengthi1024e12:piece lengthi16384e" +
+            "6:pieces20:aaaaaaaaaaaaaaaaaaaae":
+            "a04daeffb38edf7380d9d3eed19d6588644a5c36",
+    }
+
+    for info, expected := range tests {
+        torrent := "d8:announce15:http://tracker17:comment5:hello4:info" +
+            info + "e"
+
+        hash, err := bencode.InfoHash(strings.NewReader(torrent))
+        if err != nil {
+            t.Fatalf("error computing info hash: %s", err)
+        }
+        if got := hex.EncodeToString(hash[:]); got != expected {
+            t.Errorf("got info hash %s, expected %s", got, expected)
+        }
+    }
+
+    _, err := bencode.InfoHash(strings.NewReader("d3:fooi1ee"))
+    if err == nil {
+        t.Errorf("expected error for torrent without info dictionary")
+    }
+
+    for _, torrent := range []string{
+        // a key with no value before the next key
+        "d3:fooe4:infod1:ai1eee",
+        "d3:foo4:infod1:ai1eee",
+        "d3:fooli1e4:infod1:ai1eee",
+    } {
+        _, err := bencode.InfoHash(strings.NewReader(torrent))
+        if err == nil {
+            t.Errorf("expected error for malformed torrent %q", torrent)
+        }
+    }
+
+    // large values before the info dictionary are skipped
+    torrent := "d7:comment" + fmt.Sprintf("%d:", 1 << 20) +
+        strings.Repeat("x", 1 << 20) + "4:info" + test_info + "e"
+    hash, err := bencode.InfoHash(strings.NewReader(torrent))
+    if err != nil {
+        t.Fatalf("error computing info hash: %s", err)
+    }
+    if got := hex.EncodeToString(hash[:]); got !=
+        "5e73478c8951a47213df390eedca1a9e580e47cb" {
+
+        t.Errorf("got info hash %s after a large comment", got)
+    }
+}
+
+// The info dictionary of a BitTorrent v2 torrent with a single file.
+const test_info_v2 = "d9:file treed8:file.txtd0:d6:lengthi1024e" +
+    "11:pieces root32:rrrrrrrrrrrrrrrrrrrrrrrrrrrrrrrreee" +
+    "12:meta versioni2e4:name8:file.txt12:piece lengthi16384ee"
+
+const test_torrent_v2 = "d8:announce15:http://tracker14:info" +
+    test_info_v2 + "12:piece layersdee"
+
+func TestInfoHashV2(t *testing.T) {
+    hash, err := bencode.InfoHashV2(strings.NewReader(test_torrent_v2))
+    if err != nil {
+        t.Fatalf("error computing info hash: %s", err)
+    }
+
+    expected :=
+        "9fd1bdaf94b1e64b731a0a9d5553a03cf223672fd44daeaaf36330e5c1e86d69"
+    if got := hex.EncodeToString(hash[:]); got != expected {
+        t.Errorf("got info hash %s, expected %s", got, expected)
+    }
+}
+
+func TestHashInfo(t *testing.T) {
+    v1, v2 := sha1.New(), sha256.New()
+    err := bencode.HashInfo(strings.NewReader(test_torrent_v2), v1, v2)
+    if err != nil {
+        t.Fatalf("error hashing info: %s", err)
+    }
+
+    if got := hex.EncodeToString(v1.Sum(nil)); got !=
+        "43aa749aeb1a6ebba0cb1d69f588400df670c76a" {
+
+        t.Errorf("got v1 info hash %s", got)
+    }
+    if got := hex.EncodeToString(v2.Sum(nil)); got !=
+        "9fd1bdaf94b1e64b731a0a9d5553a03cf223672fd44daeaaf36330e5c1e86d69" {
+
+        t.Errorf("got v2 info hash %s", got)
+    }
+}
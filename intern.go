@@ -0,0 +1,73 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+// Byte strings no longer than this are interned.
+const max_interned_len = 64
+
+// Maximum number of distinct strings interned by a Decoder.
+const max_interned = 4096
+
+// Cause the Decoder to share the memory of repeated short byte strings, like
+// the dictionary keys "length" and "path" that appear throughout torrents,
+// rather than allocating each occurrence separately. This reduces the memory
+// held by decoded values when decoding many similar documents with the same
+// Decoder, e.g., with Reset(). The table of strings is bounded, so once it's
+// full, new strings are allocated as usual.
+func (dec *Decoder) InternStrings() {
+    if dec.interned == nil {
+        dec.interned = make(map[string]string)
+        dec.intern_buf = make([]byte, max_interned_len)
+    }
+}
+
+// Read a byte string, returning an interned copy if it's short.
+func (dec *Decoder) get_interned_string() (string, error) {
+    size, err := dec.get_checked_string_len()
+    if err != nil {
+        return "", err
+    }
+
+    p, err := dec.get_string_contents(size, dec.intern_buf)
+    if err != nil {
+        return "", err
+    }
+    if size > max_interned_len {
+        return string(p), nil
+    }
+
+    if s, ok := dec.interned[string(p)]; ok {
+        return s, nil
+    }
+
+    s := string(p)
+    if len(dec.interned) < max_interned {
+        dec.interned[s] = s
+    }
+
+    return s, nil
+}
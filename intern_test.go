@@ -0,0 +1,95 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "reflect"
+    "strings"
+    "testing"
+    "unsafe"
+)
+
+func string_data(s string) uintptr {
+    return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInternStrings(t *testing.T) {
+    data := "ld6:lengthi1e4:pathl3:dir5:a.bineed6:lengthi2e4:pathl3:dir" +
+        "5:b.bineed6:lengthi3e4:pathl3:dir" + "70:" +
+        strings.Repeat("x", 70) + "eee"
+
+    expected, err := bencode.DecodeString(data)
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    dec := bencode.NewDecoder(strings.NewReader(data))
+    dec.InternStrings()
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Fatalf("got %#v, expected %#v", got, expected)
+    }
+
+    files := got.([]interface{})
+    first := files[0].(map[string]interface{})["path"].([]interface{})
+    second := files[1].(map[string]interface{})["path"].([]interface{})
+    if string_data(first[0].(string)) != string_data(second[0].(string)) {
+        t.Errorf("repeated string values are not shared")
+    }
+    keys := map[string]uintptr{}
+    for k := range files[0].(map[string]interface{}) {
+        keys[k] = string_data(k)
+    }
+    for k := range files[1].(map[string]interface{}) {
+        if string_data(k) != keys[k] {
+            t.Errorf("repeated key %q is not shared", k)
+        }
+    }
+
+    // the table carries over to the next input
+    dec.Reset(strings.NewReader("3:dir"))
+    v, err := dec.Decode()
+    if err != nil || string_data(v.(string)) != string_data(first[0].(string)) {
+        t.Errorf("got %v, %v, expected a shared string after reset", v, err)
+    }
+}
+
+func torrent_stream(n int) []byte {
+    var buf bytes.Buffer
+    for i := 0; i < n; i++ {
+        buf.WriteString("d8:announce23:http://tracker/announce4:info" +
+            "d5:filesld6:lengthi1024e4:pathl3:dir5:a.bineed6:lengthi2048e" +
+            "4:pathl3:dir5:b.bineee4:name5:bench12:piece lengthi16384eee")
+    }
+
+    return buf.Bytes()
+}
+
+func benchmark_decode_stream(b *testing.B, intern bool) {
+    data := torrent_stream(100)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        dec := bencode.NewDecoder(bytes.NewReader(data))
+        if intern {
+            dec.InternStrings()
+        }
+        for dec.More() {
+            if _, err := dec.Decode(); err != nil {
+                b.Fatal(err)
+            }
+        }
+    }
+}
+
+func BenchmarkDecodeStream(b *testing.B) {
+    benchmark_decode_stream(b, false)
+}
+
+func BenchmarkDecodeStreamInterned(b *testing.B) {
+    benchmark_decode_stream(b, true)
+}
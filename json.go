@@ -0,0 +1,207 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Prefix marking a JSON string produced by ToJSON() as base64-encoded bytes.
+const JSONBinaryPrefix = "b64:"
+
+// Convert v, a data structure as returned by Decode(), to JSON. Dictionaries
+// become objects, lists become arrays, and integers become numbers.
+//
+// Byte strings that are valid UTF-8 become JSON strings as-is. Byte strings
+// that are not, e.g., SHA-1 hashes, are base64-encoded and given the prefix
+// JSONBinaryPrefix ("b64:"). So that this is unambiguous, a UTF-8 string that
+// itself starts with the prefix is also base64-encoded. The same applies to
+// dictionary keys. FromJSON() reverses the conversion losslessly.
+func ToJSON(v interface{}) ([]byte, error) {
+    j, err := to_json_value(v)
+    if err != nil {
+        return nil, err
+    }
+
+    return json.Marshal(j)
+}
+
+func to_json_value(v interface{}) (interface{}, error) {
+    switch val := v.(type) {
+    case map[string]interface{}:
+        obj := make(map[string]interface{}, len(val))
+        for k, elem := range val {
+            j, err := to_json_value(elem)
+            if err != nil {
+                return nil, err
+            }
+            obj[to_json_string(k)] = j
+        }
+        return obj, nil
+
+    case []interface{}:
+        arr := make([]interface{}, len(val))
+        for i, elem := range val {
+            j, err := to_json_value(elem)
+            if err != nil {
+                return nil, err
+            }
+            arr[i] = j
+        }
+        return arr, nil
+
+    case string:
+        return to_json_string(val), nil
+    case []byte:
+        return to_json_string(string(val)), nil
+    case int64, uint64:
+        return val, nil
+    case Number:
+        return json.Number(val), nil
+    case RawScalar:
+        return to_json_value(val.Value)
+    }
+
+    return nil, fmt.Errorf("don't know how to convert type %T to JSON", v)
+}
+
+func to_json_string(s string) string {
+    if utf8.ValidString(s) && !strings.HasPrefix(s, JSONBinaryPrefix) {
+        return s
+    }
+
+    return JSONBinaryPrefix + base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// Convert JSON produced by ToJSON() back to a data structure that can be
+// passed to Encode(), using the same types as Decode(). Strings with the
+// prefix JSONBinaryPrefix are base64-decoded. JSON numbers must be integers,
+// and booleans and nulls are not allowed, since Bencode has no equivalent.
+func FromJSON(data []byte) (interface{}, error) {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+
+    var j interface{}
+    if err := dec.Decode(&j); err != nil {
+        return nil, err
+    }
+
+    return from_json_value(j)
+}
+
+func from_json_value(j interface{}) (interface{}, error) {
+    switch val := j.(type) {
+    case map[string]interface{}:
+        d := make(map[string]interface{}, len(val))
+        for k, elem := range val {
+            key, err := from_json_string(k)
+            if err != nil {
+                return nil, err
+            }
+            if d[key], err = from_json_value(elem); err != nil {
+                return nil, err
+            }
+        }
+        return d, nil
+
+    case []interface{}:
+        l := make([]interface{}, len(val))
+        for i, elem := range val {
+            v, err := from_json_value(elem)
+            if err != nil {
+                return nil, err
+            }
+            l[i] = v
+        }
+        return l, nil
+
+    case string:
+        return from_json_string(val)
+
+    case json.Number:
+        if i, err := strconv.ParseInt(string(val), 10, 64); err == nil {
+            return i, nil
+        }
+        if u, err := strconv.ParseUint(string(val), 10, 64); err == nil {
+            return u, nil
+        }
+        if valid_number(string(val)) {
+            return Number(val), nil
+        }
+        return nil, fmt.Errorf("JSON number %s is not an integer", val)
+    }
+
+    return nil, fmt.Errorf("JSON value of type %T has no Bencode equivalent",
+        j)
+}
+
+func from_json_string(s string) (string, error) {
+    if !strings.HasPrefix(s, JSONBinaryPrefix) {
+        return s, nil
+    }
+
+    b, err := base64.StdEncoding.DecodeString(s[len(JSONBinaryPrefix):])
+    if err != nil {
+        return "", fmt.Errorf("invalid base64 in JSON string %q: %w", s, err)
+    }
+
+    return string(b), nil
+}
+
+// Store the JSON conversion of v in out, a []byte field tagged with the
+// "json" option.
+func set_json_field(out *reflect.Value, v interface{}) error {
+    if out.Kind() != reflect.Slice || out.Type().Elem().Kind() != reflect.Uint8 {
+        return coerce_error(reflect.TypeOf(v), out.Type(), "field with " +
+            "the json option must be a []byte, not %s", out.Type())
+    }
+
+    j, err := ToJSON(v)
+    if err != nil {
+        return coerce_error(reflect.TypeOf(v), out.Type(), "%s", err)
+    }
+    out.SetBytes(j)
+
+    return nil
+}
+
+// Return the value to encode for fv, a []byte field tagged with the "json"
+// option and holding JSON produced by ToJSON().
+func json_field_value(fv reflect.Value) (interface{}, error) {
+    if fv.Kind() != reflect.Slice || fv.Type().Elem().Kind() != reflect.Uint8 {
+        return nil, fmt.Errorf("field with the json option must be a " +
+            "[]byte, not %s", fv.Type())
+    }
+
+    return FromJSON(fv.Bytes())
+}
@@ -0,0 +1,101 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+    encoded := "d2:\x00\x01i2e8:announce14:http://tracker" +
+        "4:infod6:lengthi-10e4:name8:b64:abcd6:pieces4:\x3c\x6e\x0b\x8a" +
+        "4:sizei18446744073709551615ee4:listli1e2:\xff\xfeleee"
+
+    data, err := bencode.DecodeString(encoded)
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    j, err := bencode.ToJSON(data)
+    if err != nil {
+        t.Fatalf("error converting to JSON: %s", err)
+    }
+    if !strings.Contains(string(j), `"pieces":"b64:PG4Lig=="`) {
+        t.Errorf("binary string not base64 encoded in %s", j)
+    }
+
+    back, err := bencode.FromJSON(j)
+    if err != nil {
+        t.Fatalf("error converting from JSON %s: %s", j, err)
+    }
+
+    got, err := bencode.EncodeToString(back)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    if got != encoded {
+        t.Errorf("got %q, expected %q", got, encoded)
+    }
+}
+
+func TestFromJSONInvalid(t *testing.T) {
+    tests := []string{
+        `1.5`,
+        `true`,
+        `null`,
+        `{"a": [false]}`,
+        `"b64:!!!"`,
+    }
+
+    for _, j := range tests {
+        if _, err := bencode.FromJSON([]byte(j)); err == nil {
+            t.Errorf("expected an error converting %s", j)
+        }
+    }
+}
+
+func TestJSONField(t *testing.T) {
+    type Torrent struct {
+        Announce string `bencode:"announce"`
+        Info json.RawMessage `bencode:"info,json"`
+        Extra []byte `bencode:"extra,json,omitempty"`
+    }
+
+    data := "d8:announce3:url4:infod5:filesld6:lengthi5e4:pathl1:aeee" +
+        "4:hash2:\xff\x00ee"
+
+    var got Torrent
+    if err := bencode.Unmarshal([]byte(data), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    expected := `{"files":[{"length":5,"path":["a"]}],"hash":"b64:/wA="}`
+    if string(got.Info) != expected {
+        t.Errorf("got JSON %s, expected %s", got.Info, expected)
+    }
+    if got.Extra != nil {
+        t.Errorf("got %q for missing field, expected nil", got.Extra)
+    }
+
+    encoded, err := bencode.EncodeToString(got)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if encoded != data {
+        t.Errorf("got %q, expected %q", encoded, data)
+    }
+
+    got.Info = json.RawMessage(`{"bad": true}`)
+    if _, err := bencode.EncodeToString(got); err == nil {
+        t.Errorf("expected error encoding JSON with no Bencode equivalent")
+    }
+
+    var wrong struct {
+        Info string `bencode:"info,json"`
+    }
+    if err := bencode.Unmarshal([]byte(data), &wrong); err == nil {
+        t.Errorf("expected error decoding into a non-[]byte json field")
+    }
+}
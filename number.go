@@ -0,0 +1,125 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "fmt"
+    "math/big"
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+var big_int_type = reflect.TypeOf(big.Int{})
+var big_int_ptr_type = reflect.TypeOf(&big.Int{})
+
+// A Number holds the decimal digits of a Bencode integer, leaving its
+// interpretation to the caller. Bencode places no limit on the size of
+// integers, so this avoids losing values outside the range of int64 and
+// uint64. See Decoder.UseNumber().
+type Number string
+
+// Return the number as a string of decimal digits.
+func (n Number) String() string {
+    return string(n)
+}
+
+// Return the number as an int64, or an error if it is out of range.
+func (n Number) Int64() (int64, error) {
+    return strconv.ParseInt(string(n), 10, 64)
+}
+
+// Return the number as a uint64, or an error if it is negative or out of
+// range.
+func (n Number) Uint64() (uint64, error) {
+    return strconv.ParseUint(string(n), 10, 64)
+}
+
+// Return the number as an arbitrary-precision integer.
+func (n Number) BigInt() (*big.Int, error) {
+    i, ok := new(big.Int).SetString(string(n), 10)
+    if !ok {
+        return nil, fmt.Errorf("invalid integer %q", string(n))
+    }
+
+    return i, nil
+}
+
+// Report whether s is a valid Bencode integer: an optional minus sign
+// followed by decimal digits, with no leading zeros, and not "-0".
+func valid_number(s string) bool {
+    digits := strings.TrimPrefix(s, "-")
+    if digits == "" || (digits[0] == '0' && len(s) > 1) {
+        return false
+    }
+
+    for i := 0; i < len(digits); i++ {
+        if digits[i] < '0' || digits[i] > '9' {
+            return false
+        }
+    }
+
+    return true
+}
+
+// Cause the Decoder to return integers as a Number instead of an int64 or
+// uint64, so that integers of any size can be decoded without loss. Since
+// the digits are kept as they are, integers with leading zeros, which could
+// not be encoded again, are an error.
+func (dec *Decoder) UseNumber() {
+    dec.use_number = true
+}
+
+// Fill a big.Int or *big.Int from a decoded integer, Number, or string of
+// digits. Integers too large for a uint64 must be decoded with UseNumber().
+func (c *coercer) set_val_coerce_to_big_int(out *reflect.Value,
+    in reflect.Value) error {
+
+    b := new(big.Int)
+
+    is_signed, is_int := get_int_kind(in.Kind())
+    switch {
+    case is_int && is_signed:
+        b.SetInt64(in.Int())
+    case is_int:
+        b.SetUint64(in.Uint())
+    case in.Kind() == reflect.String:
+        if _, ok := b.SetString(in.String(), 10); !ok {
+            return coerce_error(in.Type(), out.Type(), "invalid integer %q",
+                in.String())
+        }
+    default:
+        return unsupported_coercion(out, in)
+    }
+
+    if out.Type() == big_int_ptr_type {
+        out.Set(reflect.ValueOf(b))
+    } else {
+        out.Set(reflect.ValueOf(b).Elem())
+    }
+
+    return nil
+}
@@ -0,0 +1,129 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "math/big"
+    "strings"
+    "testing"
+)
+
+func decode_number(t *testing.T, encoded string) bencode.Number {
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.UseNumber()
+
+    v, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding %q: %s", encoded, err)
+    }
+
+    n, ok := v.(bencode.Number)
+    if !ok {
+        t.Fatalf("got %T decoding %q, expected Number", v, encoded)
+    }
+
+    return n
+}
+
+func TestNumberBoundaries(t *testing.T) {
+    n := decode_number(t, "i9223372036854775807e")
+    if i, err := n.Int64(); err != nil || i != 9223372036854775807 {
+        t.Errorf("got %d, %v for max int64", i, err)
+    }
+
+    n = decode_number(t, "i-9223372036854775808e")
+    if i, err := n.Int64(); err != nil || i != -9223372036854775808 {
+        t.Errorf("got %d, %v for min int64", i, err)
+    }
+    if _, err := n.Uint64(); err == nil {
+        t.Errorf("expected error converting negative number to uint64")
+    }
+
+    n = decode_number(t, "i9223372036854775808e")
+    if _, err := n.Int64(); err == nil {
+        t.Errorf("expected error converting max int64 + 1 to int64")
+    }
+    if u, err := n.Uint64(); err != nil || u != 9223372036854775808 {
+        t.Errorf("got %d, %v for max int64 + 1", u, err)
+    }
+
+    n = decode_number(t, "i18446744073709551616e")
+    if _, err := n.Uint64(); err == nil {
+        t.Errorf("expected error converting max uint64 + 1 to uint64")
+    }
+    b, err := n.BigInt()
+    if err != nil || b.String() != "18446744073709551616" {
+        t.Errorf("got %v, %v for max uint64 + 1", b, err)
+    }
+
+    encoded, err := bencode.EncodeToString(n)
+    if err != nil {
+        t.Fatalf("error encoding number: %s", err)
+    }
+    if encoded != "i18446744073709551616e" {
+        t.Errorf("got %q, expected \"i18446744073709551616e\"", encoded)
+    }
+}
+
+func TestBigIntRoundTrip(t *testing.T) {
+    type Counters struct {
+        Ptr *big.Int
+        Val big.Int
+    }
+
+    n, ok := new(big.Int).SetString("-123456789012345678901234567890", 10)
+    if !ok {
+        t.Fatalf("couldn't create big.Int")
+    }
+
+    in := Counters{Ptr: n}
+    in.Val.SetInt64(42)
+
+    encoded, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d3:Ptri-123456789012345678901234567890e3:Vali42ee"
+    if encoded != expected {
+        t.Errorf("got %q, expected %q", encoded, expected)
+    }
+
+    var got Counters
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.UseNumber()
+    if err := dec.DecodeInto(&got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    if got.Ptr == nil || got.Ptr.Cmp(n) != 0 || got.Val.Cmp(&in.Val) != 0 {
+        t.Errorf("got %v and %v, expected %v and %v", got.Ptr, &got.Val, n,
+            &in.Val)
+    }
+}
+
+func TestNumberValidation(t *testing.T) {
+    valid := []string{"0", "7", "-7", "-1000",
+        "1234567890123456789012345678901234567890"}
+    for _, n := range valid {
+        got, err := bencode.EncodeToString(bencode.Number(n))
+        if err != nil || got != "i" + n + "e" {
+            t.Errorf("got %q, %v encoding Number %q", got, err, n)
+        }
+    }
+
+    invalid := []string{"", "-", "abc", "-0", "00", "007", "-07", "1.5",
+        "1e5", "+1", " 1", "1-"}
+    for _, n := range invalid {
+        if got, err := bencode.EncodeToString(bencode.Number(n)); err == nil {
+            t.Errorf("expected error encoding Number %q, got %q", n, got)
+        }
+    }
+
+    for _, encoded := range []string{"i00e", "i007e", "i-0e", "i-07e"} {
+        dec := bencode.NewDecoder(strings.NewReader(encoded))
+        dec.UseNumber()
+        if v, err := dec.Decode(); err == nil {
+            t.Errorf("expected error decoding %q, got %#v", encoded, v)
+        }
+    }
+}
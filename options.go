@@ -0,0 +1,204 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "io"
+    "time"
+)
+
+// Options for an Encoder, gathered in one place, for NewEncoderWithOptions().
+// Each corresponds to an Encoder method, and the zero value of each leaves
+// the default behavior.
+type MarshalOptions struct {
+    // Gives the dictionary key for struct fields without a tag name. See
+    // Encoder.SetKeyMapper().
+    KeyMapper func(field_name string) string
+
+    // Skip empty struct fields as though they were all tagged omitempty.
+    // See Encoder.OmitEmpty().
+    OmitEmpty bool
+
+    // The unit for encoding time.Time values. See Encoder.SetTimeUnit().
+    TimeUnit time.Duration
+
+    // The convention for encoding bools. See Encoder.SetBoolFormat().
+    BoolFormat BoolFormat
+
+    // Sort the keys of Pairs. See Encoder.SortPairs().
+    SortPairs bool
+
+    // Trust the key order of a DictIterator. See Encoder.AssumeSortedKeys().
+    AssumeSortedKeys bool
+
+    // Buffer and sort streamed dictionaries. See Encoder.SortStreamKeys().
+    SortStreamKeys bool
+
+    // Keys whose values are replaced with RedactPlaceholder. See
+    // Encoder.Redact().
+    RedactKeys []string
+    RedactPlaceholder string
+
+    // Called as each dictionary key is written. See Encoder.SetKeyHook().
+    KeyHook func(path []string, key string)
+
+    // Receives a description of each token written. See Encoder.SetTrace().
+    Trace io.Writer
+}
+
+// Create a new Encoder to encode data structures to Bencode on w, configured
+// with opts.
+func NewEncoderWithOptions(w io.Writer, opts MarshalOptions) *Encoder {
+    enc := NewEncoder(w)
+
+    enc.SetKeyMapper(opts.KeyMapper)
+    enc.omit_empty = opts.OmitEmpty
+    enc.SetTimeUnit(opts.TimeUnit)
+    enc.SetBoolFormat(opts.BoolFormat)
+    enc.sort_pairs = opts.SortPairs
+    enc.presorted_keys = opts.AssumeSortedKeys
+    enc.sort_stream = opts.SortStreamKeys
+    if len(opts.RedactKeys) > 0 {
+        enc.Redact(opts.RedactPlaceholder, opts.RedactKeys...)
+    }
+    enc.SetKeyHook(opts.KeyHook)
+    if opts.Trace != nil {
+        enc.SetTrace(opts.Trace)
+    }
+
+    return enc
+}
+
+// Skip struct fields with empty values when encoding, as though every field
+// were tagged omitempty.
+func (enc *Encoder) OmitEmpty() {
+    enc.omit_empty = true
+}
+
+// Options for a Decoder, gathered in one place, for NewDecoderWithOptions().
+// Each corresponds to a Decoder method, and the zero value of each leaves
+// the default, lenient, behavior.
+type DecodeOptions struct {
+    // The maximum nesting depth of lists and dictionaries. Zero leaves
+    // DefaultMaxDepth, and a negative value means no limit. See
+    // Decoder.SetMaxDepth().
+    MaxDepth int
+
+    // The maximum length of a byte string. See Decoder.SetMaxStringLen().
+    MaxStringLen int64
+
+    // The maximum input consumed per value. See Decoder.SetMaxInputBytes().
+    MaxInputBytes int64
+
+    // Reject data following the value. See Decoder.DisallowTrailingData().
+    DisallowTrailingData bool
+
+    // Reject repeated dictionary keys. See Decoder.DisallowDuplicateKeys().
+    DisallowDuplicateKeys bool
+
+    // Reject unsorted dictionary keys. See Decoder.RequireSortedKeys().
+    RequireSortedKeys bool
+
+    // Return byte strings as []byte. See Decoder.UseBytes().
+    UseBytes bool
+
+    // Return integers as Numbers. See Decoder.UseNumber().
+    UseNumber bool
+
+    // Return integers and byte strings as RawScalars. See
+    // Decoder.PreserveRaw().
+    PreserveRaw bool
+
+    // Share repeated short strings. See Decoder.InternStrings().
+    InternStrings bool
+
+    // Discard the values of these keys. See Decoder.SkipKeys().
+    SkipKeys []string
+
+    // Reject keys matching no struct field. See
+    // Decoder.DisallowUnknownFields().
+    DisallowUnknownFields bool
+
+    // Match keys to struct fields case-insensitively. See
+    // Decoder.MatchKeysCaseInsensitive().
+    MatchKeysCaseInsensitive bool
+
+    // Gives the dictionary key for struct fields without a tag name. See
+    // Decoder.SetKeyMapper().
+    KeyMapper func(field_name string) string
+
+    // Parse byte strings holding integers into integer map values. See
+    // Decoder.AllowStringInts().
+    AllowStringInts bool
+
+    // The unit for decoding time.Time values. See Decoder.SetTimeUnit().
+    TimeUnit time.Duration
+
+    // The convention for decoding bools, and whether to accept only it. See
+    // Decoder.SetBoolFormat().
+    BoolFormat BoolFormat
+    StrictBools bool
+
+    // Called with each decoded value. See Decoder.SetValueHook().
+    ValueHook func(path []string, v interface{}) (interface{}, error)
+}
+
+// Create a new Decoder to decode data structures from r, configured with
+// opts.
+func NewDecoderWithOptions(r io.Reader, opts DecodeOptions) *Decoder {
+    dec := NewDecoder(r)
+
+    if opts.MaxDepth != 0 {
+        dec.SetMaxDepth(opts.MaxDepth)
+    }
+    dec.SetMaxStringLen(opts.MaxStringLen)
+    dec.SetMaxInputBytes(opts.MaxInputBytes)
+    dec.disallow_trailing = opts.DisallowTrailingData
+    dec.disallow_dups = opts.DisallowDuplicateKeys
+    dec.require_sorted = opts.RequireSortedKeys
+    dec.use_bytes = opts.UseBytes
+    dec.use_number = opts.UseNumber
+    dec.preserve_raw = opts.PreserveRaw
+    if opts.InternStrings {
+        dec.InternStrings()
+    }
+    if len(opts.SkipKeys) > 0 {
+        dec.SkipKeys(opts.SkipKeys...)
+    }
+
+    dec.coercer.disallow_unknown = opts.DisallowUnknownFields
+    dec.coercer.fold_keys = opts.MatchKeysCaseInsensitive
+    dec.SetKeyMapper(opts.KeyMapper)
+    dec.coercer.string_ints = opts.AllowStringInts
+    dec.SetTimeUnit(opts.TimeUnit)
+    dec.SetBoolFormat(opts.BoolFormat, opts.StrictBools)
+    if opts.ValueHook != nil {
+        dec.SetValueHook(opts.ValueHook)
+    }
+
+    return dec
+}
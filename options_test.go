@@ -0,0 +1,127 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestNewEncoderWithOptions(t *testing.T) {
+    type Torrent struct {
+        AnnounceUrl string
+        CreatedBy string
+        CreationDate time.Time
+        Private bool
+        Passkey string `bencode:"passkey"`
+        Comment *string
+    }
+
+    in := Torrent{
+        AnnounceUrl: "http://tracker",
+        CreationDate: time.Unix(1600000000, 0),
+        Private: true,
+        Passkey: "secret",
+    }
+
+    var buf, trace bytes.Buffer
+    enc := bencode.NewEncoderWithOptions(&buf, bencode.MarshalOptions{
+        KeyMapper: kebab_case,
+        OmitEmpty: true,
+        TimeUnit: time.Millisecond,
+        BoolFormat: bencode.BoolString,
+        RedactKeys: []string{"passkey"},
+        RedactPlaceholder: "X",
+        Trace: &trace,
+    })
+    if err := enc.Encode(in); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d12:announce-url14:http://tracker" +
+        "13:creation-datei1600000000000e7:passkey1:X7:private4:truee"
+    if buf.String() != expected {
+        t.Errorf("got %q, expected %q", buf.String(), expected)
+    }
+    if !strings.HasPrefix(trace.String(), "[0, 1) dict\n") {
+        t.Errorf("got trace %q", trace.String())
+    }
+
+    // the zero value matches NewEncoder()
+    buf.Reset()
+    enc = bencode.NewEncoderWithOptions(&buf, bencode.MarshalOptions{})
+    in.Comment = new(string)
+    if err := enc.Encode(in); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    plain, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if buf.String() != plain {
+        t.Errorf("got %q with default options, expected %q", buf.String(),
+            plain)
+    }
+}
+
+func TestNewDecoderWithOptions(t *testing.T) {
+    strict := bencode.DecodeOptions{
+        MaxDepth: 3,
+        MaxStringLen: 8,
+        MaxInputBytes: 64,
+        DisallowTrailingData: true,
+        DisallowDuplicateKeys: true,
+        RequireSortedKeys: true,
+    }
+
+    tests := map[string]string{
+        "max depth": "llllee" + "ee",
+        "max string length": "9:aaaaaaaaa",
+        "max input bytes": "l" + strings.Repeat("i1e", 30) + "e",
+        "trailing data": "i1ei2e",
+        "duplicate keys": "d1:ai1e1:ai2ee",
+        "unsorted keys": "d1:bi1e1:ai2ee",
+    }
+    for name, data := range tests {
+        dec := bencode.NewDecoderWithOptions(strings.NewReader(data), strict)
+        if _, err := dec.Decode(); err == nil {
+            t.Errorf("%s: expected error decoding %q", name, data)
+        }
+
+        // the defaults are lenient
+        dec = bencode.NewDecoderWithOptions(strings.NewReader(data),
+            bencode.DecodeOptions{})
+        if _, err := dec.Decode(); err != nil {
+            t.Errorf("%s: error decoding %q with default options: %s", name,
+                data, err)
+        }
+    }
+
+    // duplicates are caught without requiring sorted keys
+    dec := bencode.NewDecoderWithOptions(strings.NewReader("d1:bi1e1:ai2ee"),
+        bencode.DecodeOptions{DisallowDuplicateKeys: true})
+    if _, err := dec.Decode(); err != nil {
+        t.Errorf("error decoding unsorted keys: %s", err)
+    }
+
+    var v struct {
+        Name string `bencode:"name"`
+    }
+    dec = bencode.NewDecoderWithOptions(strings.NewReader("d4:name1:x1:zi1ee"),
+        bencode.DecodeOptions{DisallowUnknownFields: true})
+    if err := dec.DecodeInto(&v); err == nil {
+        t.Errorf("expected unknown field error")
+    }
+
+    dec = bencode.NewDecoderWithOptions(strings.NewReader("l2:abi7ee"),
+        bencode.DecodeOptions{UseBytes: true, UseNumber: true})
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    l := got.([]interface{})
+    if _, ok := l[0].([]byte); !ok || l[1] != bencode.Number("7") {
+        t.Errorf("got %#v, expected []byte and Number values", l)
+    }
+}
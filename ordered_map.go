@@ -0,0 +1,96 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "sort"
+)
+
+// Implemented by dictionary types that supply their own key order.
+type ordered_dict interface {
+    dict_keys() []string
+    dict_value(key string) interface{}
+}
+
+// An OrderedMap is a dictionary with values of type V that tracks the order
+// in which its keys were added. It encodes as a Bencode dictionary, with its
+// keys sorted canonically unless InsertionOrder is set.
+//
+// The zero value is an empty map ready to use.
+type OrderedMap[V any] struct {
+    // The keys, in insertion order.
+    Keys []string
+
+    // If set, emit keys in insertion order instead of sorted order when
+    // encoding. Note that this produces a non-canonical dictionary.
+    InsertionOrder bool
+
+    values map[string]V
+}
+
+// Create a new, empty OrderedMap.
+func NewOrderedMap[V any]() *OrderedMap[V] {
+    return &OrderedMap[V]{values: map[string]V{}}
+}
+
+// Set the value for key. A new key is added after any existing keys;
+// setting an existing key keeps its position.
+func (m *OrderedMap[V]) Set(key string, v V) {
+    if m.values == nil {
+        m.values = map[string]V{}
+    }
+
+    if _, ok := m.values[key]; !ok {
+        m.Keys = append(m.Keys, key)
+    }
+    m.values[key] = v
+}
+
+// Get the value for key, and whether it was present.
+func (m *OrderedMap[V]) Get(key string) (V, bool) {
+    v, ok := m.values[key]
+    return v, ok
+}
+
+// Return the number of keys in the map.
+func (m *OrderedMap[V]) Len() int {
+    return len(m.Keys)
+}
+
+func (m OrderedMap[V]) dict_keys() []string {
+    keys := make([]string, len(m.Keys))
+    copy(keys, m.Keys)
+
+    if !m.InsertionOrder {
+        sort.Strings(keys)
+    }
+
+    return keys
+}
+
+func (m OrderedMap[V]) dict_value(key string) interface{} {
+    return m.values[key]
+}
@@ -0,0 +1,39 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "testing"
+)
+
+func TestEncodeOrderedMap(t *testing.T) {
+    m := bencode.NewOrderedMap[int64]()
+    m.Set("length", 10)
+    m.Set("count", 2)
+    m.Set("age", 7)
+    m.Set("length", 20)
+
+    if v, ok := m.Get("length"); !ok || v != 20 {
+        t.Errorf("got %d, %t for key \"length\", expected 20, true", v, ok)
+    }
+
+    got, err := bencode.EncodeToString(m)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d3:agei7e5:counti2e6:lengthi20ee"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+
+    m.InsertionOrder = true
+    got, err = bencode.EncodeToString(m)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected = "d6:lengthi20e5:counti2e3:agei7ee"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+}
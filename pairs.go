@@ -0,0 +1,78 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "fmt"
+    "sort"
+)
+
+// A Pair is a dictionary entry in Pairs.
+type Pair struct {
+    Key string
+    Value interface{}
+}
+
+// Pairs is a dictionary given as a list of entries. It encodes as a Bencode
+// dictionary with its keys in the order given, e.g., for a signing scheme that
+// dictates the layout, unless Encoder.SortPairs() has been called. Note that
+// unsorted keys produce a non-canonical dictionary. Keys must be unique.
+type Pairs []Pair
+
+// Cause the Encoder to sort the keys of Pairs canonically, as it does for
+// maps, instead of emitting them in the order given.
+func (enc *Encoder) SortPairs() {
+    enc.sort_pairs = true
+}
+
+func (enc *Encoder) encode_pairs(pairs Pairs) error {
+    seen := make(map[string]bool, len(pairs))
+    for _, p := range pairs {
+        if seen[p.Key] {
+            return fmt.Errorf("duplicate dictionary key %q in Pairs", p.Key)
+        }
+        seen[p.Key] = true
+    }
+
+    if enc.sort_pairs {
+        sorted := make(Pairs, len(pairs))
+        copy(sorted, pairs)
+        sort.Slice(sorted, func(i, j int) bool {
+            return sorted[i].Key < sorted[j].Key
+        })
+        pairs = sorted
+    }
+
+    enc.w.Write([]byte{'d'})
+    for _, p := range pairs {
+        if err := enc.write_dict_entry(p.Key, p.Value); err != nil {
+            return err
+        }
+    }
+    _, err := enc.w.Write([]byte{'e'})
+
+    return err
+}
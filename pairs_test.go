@@ -0,0 +1,49 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "testing"
+)
+
+func TestPairs(t *testing.T) {
+    pairs := bencode.Pairs{
+        {"sig", "xyz"},
+        {"body", bencode.Pairs{{"b", 2}, {"a", 1}}},
+        {"alg", "ed25519"},
+    }
+
+    got, err := bencode.EncodeToString(pairs)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d3:sig3:xyz4:bodyd1:bi2e1:ai1ee3:alg7:ed25519e"
+    if got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+
+    buf := new(bytes.Buffer)
+    enc := bencode.NewEncoder(buf)
+    enc.SortPairs()
+    if err := enc.Encode(pairs); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected = "d3:alg7:ed255194:bodyd1:ai1e1:bi2ee3:sig3:xyze"
+    if buf.String() != expected {
+        t.Errorf("got %q, expected %q", buf.String(), expected)
+    }
+
+    // sorting doesn't modify the Pairs
+    if pairs[0].Key != "sig" {
+        t.Errorf("pairs were reordered: %v", pairs)
+    }
+}
+
+func TestPairsDuplicateKey(t *testing.T) {
+    _, err := bencode.EncodeToString(bencode.Pairs{{"a", 1}, {"a", 2}})
+    if err == nil {
+        t.Errorf("expected an error for a duplicate key")
+    }
+}
@@ -0,0 +1,113 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+// Return the value found by following path through tree, a value as returned
+// by Decode(), along with whether it was found. Each element of path is either
+// a string key into a dictionary or an int index into a list, e.g.,
+//
+//     length, ok := bencode.Get(torrent, "info", "files", 0, "length")
+//
+// A missing key, an out-of-range index, or a path element that doesn't match
+// the type of the value it is applied to, e.g., an index into a dictionary,
+// results in false being returned.
+func Get(tree interface{}, path ...interface{}) (interface{}, bool) {
+    v := tree
+    for _, elem := range path {
+        switch key := elem.(type) {
+        case string:
+            dict, ok := v.(map[string]interface{})
+            if !ok {
+                return nil, false
+            }
+            if v, ok = dict[key]; !ok {
+                return nil, false
+            }
+
+        case int:
+            list, ok := v.([]interface{})
+            if !ok || key < 0 || key >= len(list) {
+                return nil, false
+            }
+            v = list[key]
+
+        default:
+            return nil, false
+        }
+    }
+
+    return v, true
+}
+
+// Return the byte string found by following path through tree, as with Get(),
+// along with whether it was found and is a byte string.
+func GetString(tree interface{}, path ...interface{}) (string, bool) {
+    v, _ := Get(tree, path...)
+    switch val := v.(type) {
+    case string:
+        return val, true
+    case []byte:
+        return string(val), true
+    }
+
+    return "", false
+}
+
+// Return the integer found by following path through tree, as with Get(),
+// along with whether it was found and is an integer that fits in an int64.
+func GetInt(tree interface{}, path ...interface{}) (int64, bool) {
+    v, _ := Get(tree, path...)
+    switch val := v.(type) {
+    case int64:
+        return val, true
+    case Number:
+        i, err := val.Int64()
+        return i, err == nil
+    }
+
+    return 0, false
+}
+
+// Return the list found by following path through tree, as with Get(), along
+// with whether it was found and is a list.
+func GetList(tree interface{}, path ...interface{}) ([]interface{}, bool) {
+    v, _ := Get(tree, path...)
+    list, ok := v.([]interface{})
+
+    return list, ok
+}
+
+// Return the dictionary found by following path through tree, as with Get(),
+// along with whether it was found and is a dictionary.
+func GetDict(tree interface{},
+    path ...interface{}) (map[string]interface{}, bool) {
+
+    v, _ := Get(tree, path...)
+    dict, ok := v.(map[string]interface{})
+
+    return dict, ok
+}
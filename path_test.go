@@ -0,0 +1,119 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "strings"
+    "testing"
+)
+
+func TestGet(t *testing.T) {
+    torrent := decoded_torrent(t)
+
+    found := map[string]struct {
+        path []interface{}
+        expected interface{}
+    }{
+        "top-level key": {[]interface{}{"comment"}, "test"},
+        "nested key": {[]interface{}{"info", "name"}, "bench"},
+        "list index": {[]interface{}{"info", "files", 1, "length"}, int64(2048)},
+        "nested lists": {[]interface{}{"announce-list", 1, 0}, "udp://other"},
+    }
+
+    for name, test := range found {
+        got, ok := bencode.Get(torrent, test.path...)
+        if !ok {
+            t.Errorf("%s: path %v not found", name, test.path)
+            continue
+        }
+        if got != test.expected {
+            t.Errorf("%s: got %#v, expected %#v", name, got, test.expected)
+        }
+    }
+
+    if got, ok := bencode.Get(torrent); !ok || got == nil {
+        t.Errorf("expected an empty path to return the tree itself")
+    }
+
+    missing := map[string][]interface{}{
+        "missing key": {"info", "nope"},
+        "index out of range": {"info", "files", 2},
+        "negative index": {"info", "files", -1},
+        "index into dict": {"info", 0},
+        "key into list": {"info", "files", "length"},
+        "index into string": {"comment", 0},
+        "key into int": {"creation date", "x"},
+        "unsupported path type": {"info", 1.5},
+    }
+
+    for name, path := range missing {
+        if got, ok := bencode.Get(torrent, path...); ok {
+            t.Errorf("%s: expected path %v not to be found, got %#v", name,
+                path, got)
+        }
+    }
+}
+
+func TestTypedGetters(t *testing.T) {
+    torrent := decoded_torrent(t)
+
+    if s, ok := bencode.GetString(torrent, "info", "name"); !ok || s != "bench" {
+        t.Errorf("GetString: got %q, %t", s, ok)
+    }
+    if _, ok := bencode.GetString(torrent, "creation date"); ok {
+        t.Errorf("GetString: expected an integer not to be a string")
+    }
+    if _, ok := bencode.GetString(torrent, "info", "nope"); ok {
+        t.Errorf("GetString: expected missing path not to be found")
+    }
+
+    n, ok := bencode.GetInt(torrent, "info", "files", 0, "length")
+    if !ok || n != 1024 {
+        t.Errorf("GetInt: got %d, %t", n, ok)
+    }
+    if _, ok := bencode.GetInt(torrent, "comment"); ok {
+        t.Errorf("GetInt: expected a string not to be an integer")
+    }
+    if _, ok := bencode.GetInt(torrent, "info", "files", 5, "length"); ok {
+        t.Errorf("GetInt: expected missing path not to be found")
+    }
+
+    list, ok := bencode.GetList(torrent, "info", "files", 1, "path")
+    if !ok || len(list) != 2 || list[1] != "b.bin" {
+        t.Errorf("GetList: got %#v, %t", list, ok)
+    }
+    if _, ok := bencode.GetList(torrent, "info"); ok {
+        t.Errorf("GetList: expected a dictionary not to be a list")
+    }
+    if _, ok := bencode.GetList(torrent, "nope"); ok {
+        t.Errorf("GetList: expected missing path not to be found")
+    }
+
+    dict, ok := bencode.GetDict(torrent, "info")
+    if !ok || dict["name"] != "bench" {
+        t.Errorf("GetDict: got %#v, %t", dict, ok)
+    }
+    if _, ok := bencode.GetDict(torrent, "announce-list"); ok {
+        t.Errorf("GetDict: expected a list not to be a dictionary")
+    }
+    if _, ok := bencode.GetDict(torrent, "info", "files", 0, "x"); ok {
+        t.Errorf("GetDict: expected missing path not to be found")
+    }
+}
+
+func TestTypedGettersAltTypes(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("d1:ai123e1:b3:xyze"))
+    dec.UseNumber()
+    dec.UseBytes()
+
+    tree, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    if n, ok := bencode.GetInt(tree, "a"); !ok || n != 123 {
+        t.Errorf("GetInt: got %d, %t for a Number", n, ok)
+    }
+    if s, ok := bencode.GetString(tree, "b"); !ok || s != "xyz" {
+        t.Errorf("GetString: got %q, %t for a []byte", s, ok)
+    }
+}
@@ -0,0 +1,63 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+// A token read ahead by Peek().
+type peeked_token struct {
+    token Token
+    err error
+    // offset of the start of the token
+    start uint64
+    // encoding of the token
+    raw []byte
+}
+
+// Return the next token, as Token() does, without consuming it: the next
+// call to Token(), Decode(), or DecodeInto() starts with the same token.
+// Calling Peek() again before then returns the same token. Until the token
+// is consumed, InputOffset() reports the offset of its start.
+//
+// Only one token of lookahead is supported, so a peeked byte string is held
+// in memory even if it is then read with StringReader().
+func (dec *Decoder) Peek() (Token, error) {
+    if p := dec.peeked; p != nil {
+        return p.token, p.err
+    }
+
+    if err := dec.skip_string_reader(); err != nil {
+        return nil, err
+    }
+
+    p := &peeked_token{start: dec.r.Tell()}
+
+    dec.r.start_record()
+    p.token, p.err = dec.Token()
+    p.raw = dec.r.stop_record()
+
+    dec.peeked = p
+
+    return p.token, p.err
+}
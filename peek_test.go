@@ -0,0 +1,97 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestPeek(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("d1:ai1eei5e"))
+
+    for i := 0; i < 2; i++ {
+        token, err := dec.Peek()
+        if err != nil || token != bencode.Delim('d') {
+            t.Fatalf("got %v, %v, expected dict start", token, err)
+        }
+        if dec.InputOffset() != 0 {
+            t.Errorf("got offset %d after peeking, expected 0",
+                dec.InputOffset())
+        }
+    }
+
+    got, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if !reflect.DeepEqual(got, map[string]interface{}{"a": int64(1)}) {
+        t.Errorf("got %#v", got)
+    }
+    if dec.InputOffset() != 8 {
+        t.Errorf("got offset %d, expected 8", dec.InputOffset())
+    }
+
+    token, err := dec.Peek()
+    if err != nil || token != int64(5) {
+        t.Fatalf("got %v, %v, expected 5", token, err)
+    }
+    if dec.InputOffset() != 8 || !dec.More() {
+        t.Errorf("got offset %d, expected 8 with more input",
+            dec.InputOffset())
+    }
+    if token, err := dec.Token(); err != nil || token != int64(5) {
+        t.Errorf("got %v, %v, expected 5", token, err)
+    }
+    if dec.InputOffset() != 11 {
+        t.Errorf("got offset %d, expected 11", dec.InputOffset())
+    }
+
+    if _, err := dec.Peek(); err != io.EOF {
+        t.Errorf("got error %v, expected EOF", err)
+    }
+    if dec.More() {
+        t.Errorf("expected no more input")
+    }
+}
+
+func TestPeekRawDict(t *testing.T) {
+    type Torrent struct {
+        Info bencode.RawDict `bencode:"info"`
+    }
+
+    encoded := "d4:infod4:name1:xee"
+    dec := bencode.NewDecoder(strings.NewReader(encoded))
+    dec.Peek()
+
+    var got Torrent
+    if err := dec.DecodeInto(&got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    if string(got.Info.Raw) != "d4:name1:xe" {
+        t.Errorf("got raw %q", got.Info.Raw)
+    }
+}
+
+func TestPeekStringReader(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("5:helloi1e"))
+    dec.Peek()
+
+    sr, length, err := dec.StringReader()
+    if err != nil {
+        t.Fatalf("error getting string reader: %s", err)
+    }
+    b, _ := io.ReadAll(sr)
+    if string(b) != "hello" || length != 5 {
+        t.Errorf("got %q with length %d", b, length)
+    }
+
+    dec.Peek()
+    if _, _, err := dec.StringReader(); err == nil {
+        t.Errorf("expected an error for a peeked integer")
+    }
+    if token, err := dec.Token(); err != nil || token != int64(1) {
+        t.Errorf("got %v, %v, expected 1", token, err)
+    }
+}
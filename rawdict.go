@@ -0,0 +1,132 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "reflect"
+)
+
+// A RawDict holds a decoded dictionary along with its exact encoding. Use it
+// as the type of a struct field to both inspect a sub-dictionary and, e.g.,
+// hash it, without decoding it twice:
+//
+//     type Torrent struct {
+//         Announce string  `bencode:"announce"`
+//         Info     RawDict `bencode:"info"`
+//     }
+//
+// Raw is only populated when decoding with Decoder.DecodeInto() or
+// Unmarshal(), as FillData() has no access to the original encoding. When
+// encoding, Raw is written as is if set; otherwise Map is encoded.
+type RawDict struct {
+    Map map[string]interface{}
+    Raw []byte
+}
+
+var raw_dict_type = reflect.TypeOf(RawDict{})
+
+// Report whether values of type t may contain a value of type target.
+func type_contains(t, target reflect.Type, seen map[reflect.Type]bool) bool {
+    if t == target {
+        return true
+    }
+    if seen[t] {
+        return false
+    }
+    seen[t] = true
+
+    switch t.Kind() {
+    case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+        return type_contains(t.Elem(), target, seen)
+    case reflect.Struct:
+        for i := 0; i < t.NumField(); i++ {
+            if type_contains(t.Field(i).Type, target, seen) {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+// Decode the next value, keeping the encoding of each dictionary in it so
+// that RawDict values can be filled.
+func (dec *Decoder) decode_with_raw_dicts() (interface{}, error) {
+    dec.dict_spans = make(map[uintptr][2]uint64)
+    dec.dict_base = dec.r.Tell()
+    dec.r.start_record()
+    if dec.peeked != nil {
+        // the first token has already been read
+        dec.dict_base = dec.peeked.start
+        dec.r.recs[len(dec.r.recs) - 1].Write(dec.peeked.raw)
+    }
+
+    data, err := dec.Decode()
+
+    raw := dec.r.stop_record()
+    spans := dec.dict_spans
+    dec.dict_spans = nil
+    if err != nil {
+        return nil, err
+    }
+
+    dec.coercer.raw_dicts = make(map[uintptr][]byte, len(spans))
+    for ptr, span := range spans {
+        dec.coercer.raw_dicts[ptr] = raw[span[0]:span[1]:span[1]]
+    }
+
+    return data, nil
+}
+
+// Note the span of the encoding of the dictionary, d, that started at byte
+// offset start, if RawDict values are being filled.
+func (dec *Decoder) record_dict_span(d map[string]interface{}, start uint64) {
+    if dec.dict_spans == nil {
+        return
+    }
+
+    ptr := reflect.ValueOf(d).Pointer()
+    dec.dict_spans[ptr] = [2]uint64{start - dec.dict_base,
+        dec.r.Tell() - dec.dict_base}
+}
+
+func (c *coercer) set_val_coerce_to_raw_dict(out *reflect.Value,
+    in reflect.Value) error {
+
+    d, ok := in.Interface().(map[string]interface{})
+    if !ok {
+        return unsupported_coercion(out, in)
+    }
+
+    rd := RawDict{Map: d}
+    if c.raw_dicts != nil {
+        rd.Raw = c.raw_dicts[reflect.ValueOf(d).Pointer()]
+    }
+
+    out.Set(reflect.ValueOf(rd))
+
+    return nil
+}
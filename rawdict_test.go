@@ -0,0 +1,43 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "testing"
+)
+
+func TestUnmarshalRawDict(t *testing.T) {
+    type Torrent struct {
+        Announce string `bencode:"announce"`
+        Info bencode.RawDict `bencode:"info"`
+    }
+
+    // the info dictionary's keys are deliberately out of order, so that a
+    // re-encoding would not match
+    info := "d4:name8:file.txt6:lengthi1024ee"
+    encoded := "d8:announce3:url4:info" + info + "e"
+
+    var got Torrent
+    if err := bencode.Unmarshal([]byte(encoded), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    if got.Announce != "url" {
+        t.Errorf("got announce %q, expected \"url\"", got.Announce)
+    }
+
+    if got.Info.Map["name"] != "file.txt" || got.Info.Map["length"] != int64(1024) {
+        t.Errorf("got info map %v", got.Info.Map)
+    }
+
+    if string(got.Info.Raw) != info {
+        t.Errorf("got raw info %q, expected %q", got.Info.Raw, info)
+    }
+
+    reencoded, err := bencode.EncodeToString(got)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if reencoded != encoded {
+        t.Errorf("got %q, expected %q", reencoded, encoded)
+    }
+}
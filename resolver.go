@@ -0,0 +1,134 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "fmt"
+    "reflect"
+    "sync"
+)
+
+// Chooses the concrete type to fill for an interface type.
+type resolver struct {
+    // the dictionary key holding the discriminator
+    key string
+    resolve func(kind string) interface{}
+}
+
+var resolvers = struct {
+    sync.RWMutex
+    m map[reflect.Type]*resolver
+}{m: make(map[reflect.Type]*resolver)}
+
+// Register a function to choose the concrete type FillData() and
+// Decoder.DecodeInto() fill when the destination is of interface type T and
+// the decoded value is a dictionary. The value of the dictionary's key entry,
+// its discriminator, is passed to resolve, which returns a pointer to a new
+// value to fill, e.g.,
+//
+//     bencode.RegisterResolver("type", func(kind string) Shape {
+//         switch kind {
+//         case "circle":
+//             return &Circle{}
+//         case "square":
+//             return &Square{}
+//         }
+//         return nil
+//     })
+//
+// A dictionary without the key, or with a discriminator for which resolve
+// returns nil, is an error. Registering another resolver for T replaces the
+// previous one, and a nil resolve removes it. RegisterResolver() panics if T
+// is not an interface type.
+func RegisterResolver[T any](key string, resolve func(kind string) T) {
+    t := reflect.TypeOf((*T)(nil)).Elem()
+    if t.Kind() != reflect.Interface {
+        panic(fmt.Sprintf("bencode: can't register a resolver for %s, " +
+            "which is not an interface type", t))
+    }
+
+    resolvers.Lock()
+    defer resolvers.Unlock()
+
+    if resolve == nil {
+        delete(resolvers.m, t)
+        return
+    }
+
+    resolvers.m[t] = &resolver{key: key,
+        resolve: func(kind string) interface{} { return resolve(kind) }}
+}
+
+func lookup_resolver(t reflect.Type) *resolver {
+    resolvers.RLock()
+    defer resolvers.RUnlock()
+
+    return resolvers.m[t]
+}
+
+// Fill the value chosen by r for the dictionary, in, and store it in out.
+func (c *coercer) set_val_coerce_resolved(out *reflect.Value, in reflect.Value,
+    r *resolver) error {
+
+    disc := in.MapIndex(reflect.ValueOf(r.key))
+    for disc.IsValid() && disc.Kind() == reflect.Interface {
+        disc = disc.Elem()
+    }
+
+    var kind string
+    switch {
+    case !disc.IsValid():
+        return coerce_error(in.Type(), out.Type(), "dictionary for %s has " +
+            "no %q key", out.Type(), r.key)
+    case disc.Kind() == reflect.String:
+        kind = disc.String()
+    case disc.Kind() == reflect.Slice && disc.Type().Elem().Kind() ==
+        reflect.Uint8:
+        kind = string(disc.Bytes())
+    default:
+        return coerce_error(in.Type(), out.Type(), "%q key of dictionary " +
+            "for %s is not a byte string", r.key, out.Type())
+    }
+
+    chosen := reflect.ValueOf(r.resolve(kind))
+    if !chosen.IsValid() || (chosen.Kind() == reflect.Ptr && chosen.IsNil()) {
+        return coerce_error(in.Type(), out.Type(), "unknown %s %q for %s",
+            r.key, kind, out.Type())
+    }
+    if chosen.Kind() != reflect.Ptr {
+        return coerce_error(in.Type(), out.Type(), "resolver for %s " +
+            "returned %s, not a pointer", out.Type(), chosen.Type())
+    }
+
+    elem := chosen.Elem()
+    if err := c.set_val_coerce(&elem, in); err != nil {
+        return err
+    }
+    out.Set(chosen)
+
+    return nil
+}
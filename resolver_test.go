@@ -0,0 +1,114 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+type shape interface {
+    area() int64
+}
+
+type circle struct {
+    Type string `bencode:"type"`
+    Radius int64 `bencode:"radius"`
+}
+
+func (c *circle) area() int64 {
+    return 3 * c.Radius * c.Radius
+}
+
+type rect struct {
+    Type string `bencode:"type"`
+    Width int64 `bencode:"width"`
+    Height int64 `bencode:"height"`
+}
+
+func (r *rect) area() int64 {
+    return r.Width * r.Height
+}
+
+func init() {
+    bencode.RegisterResolver("type", func(kind string) shape {
+        switch kind {
+        case "circle":
+            return &circle{}
+        case "rect":
+            return &rect{}
+        }
+        return nil
+    })
+}
+
+func TestResolver(t *testing.T) {
+    var drawing struct {
+        Main shape `bencode:"main"`
+        Shapes []shape `bencode:"shapes"`
+    }
+
+    data := "d4:maind6:radiusi2e4:type6:circlee6:shapesl" +
+        "d6:heighti3e4:type4:rect5:widthi4ee" +
+        "d6:radiusi1e4:type6:circleeee"
+    if err := bencode.Unmarshal([]byte(data), &drawing); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    if !reflect.DeepEqual(drawing.Main, &circle{"circle", 2}) {
+        t.Errorf("got main shape %#v", drawing.Main)
+    }
+
+    expected := []shape{&rect{"rect", 4, 3}, &circle{"circle", 1}}
+    if !reflect.DeepEqual(drawing.Shapes, expected) {
+        t.Errorf("got shapes %#v, expected %#v", drawing.Shapes, expected)
+    }
+    if got := drawing.Shapes[0].area() + drawing.Shapes[1].area(); got != 15 {
+        t.Errorf("got total area %d, expected 15", got)
+    }
+
+    var s shape
+    err := bencode.FillData(&s, map[string]interface{}{"type": []byte("rect"),
+        "width": int64(2), "height": int64(5)})
+    if err != nil {
+        t.Fatalf("error filling data: %s", err)
+    }
+    if s.area() != 10 {
+        t.Errorf("got %#v", s)
+    }
+}
+
+func TestResolverErrors(t *testing.T) {
+    tests := map[string]string{
+        "unknown discriminator": "d4:type8:triangle5:widthi1ee",
+        "no discriminator": "d5:widthi1ee",
+        "discriminator not a string": "d4:typei1ee",
+        "field mismatch": "d6:radius1:x4:type6:circlee",
+    }
+
+    for name, data := range tests {
+        var s shape
+        err := bencode.Unmarshal([]byte(data), &s)
+        if err == nil {
+            t.Errorf("%s: expected an error", name)
+            continue
+        }
+        if name == "unknown discriminator" &&
+            !strings.Contains(err.Error(), "triangle") {
+
+            t.Errorf("%s: error %q doesn't name the discriminator", name, err)
+        }
+    }
+}
+
+func TestRegisterResolverNotInterface(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Errorf("expected a panic registering a non-interface type")
+        }
+    }()
+
+    bencode.RegisterResolver("type", func(kind string) *circle {
+        return &circle{}
+    })
+}
@@ -0,0 +1,106 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "io"
+)
+
+// Discard the values of the given dictionary keys, in dictionaries at any
+// level, instead of decoding them, e.g., to read the metadata of a torrent
+// without holding its "pieces" in memory:
+//
+//     dec.SkipKeys("pieces")
+//
+// Skipped keys are absent from the decoded dictionaries. Their values are
+// consumed from the input without being buffered, but must still be
+// well-formed.
+func (dec *Decoder) SkipKeys(keys ...string) {
+    if dec.skip_keys == nil {
+        dec.skip_keys = make(map[string]bool, len(keys))
+    }
+    for _, k := range keys {
+        dec.skip_keys[k] = true
+    }
+}
+
+// Consume the next value from the input without decoding it. Byte strings
+// are discarded as they are read, so no memory is allocated for them.
+func (dec *Decoder) discard_value() error {
+    r := dec.r
+    b := []byte{0}
+    depth := 0
+
+    for {
+        if _, err := r.Read(b); err != nil {
+            return unexpected_eof(err)
+        }
+
+        switch s := b[0]; {
+        case s == 'i':
+            if _, err := dec.read_digits('e'); err != nil {
+                return unexpected_eof(err)
+            }
+        case s == 'l' || s == 'd':
+            depth++
+        case s == 'e' && depth > 0:
+            depth--
+        case s >= '0' && s <= '9':
+            r.UnreadByte()
+            size, err := dec.get_string_len()
+            if err != nil {
+                return unexpected_eof(err)
+            }
+            if _, err := io.CopyN(io.Discard, r, size); err != nil {
+                return unexpected_eof(err)
+            }
+        default:
+            return syntax_error(r.Tell() - 1, "unexpected byte %q (0x%02x) " +
+                "at byte %d", s, s, r.Tell() - 1)
+        }
+
+        if depth == 0 {
+            return nil
+        }
+    }
+}
+
+// Return the dictionary key held by token as a string.
+func key_string(token Token) string {
+    if raw, ok := token.(RawScalar); ok {
+        token = raw.Value
+    }
+
+    switch k := token.(type) {
+    case string:
+        return k
+    case []byte:
+        return string(k)
+    }
+
+    return ""
+}
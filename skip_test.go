@@ -0,0 +1,103 @@
+package bencode_test
+
+import (
+    "fmt"
+    bencode "github.com/cuberat/go-bencode"
+    "io"
+    "reflect"
+    "runtime"
+    "strings"
+    "testing"
+)
+
+func TestSkipKeys(t *testing.T) {
+    torrent := "d8:announce14:http://tracker4:info" + test_info + "e"
+    next := "i42e"
+
+    dec := bencode.NewDecoder(strings.NewReader(torrent + next))
+    dec.SkipKeys("pieces")
+
+    v, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    expected := map[string]interface{}{
+        "announce": "http://tracker",
+        "info": map[string]interface{}{
+            "length": int64(1024),
+            "name": "file.txt",
+            "piece length": int64(16384),
+        },
+    }
+    if !reflect.DeepEqual(v, expected) {
+        t.Errorf("got %#v, expected %#v", v, expected)
+    }
+
+    if offset := dec.InputOffset(); offset != int64(len(torrent)) {
+        t.Errorf("got offset %d, expected %d", offset, len(torrent))
+    }
+
+    v, err = dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding value after skipped key: %s", err)
+    }
+    if v != int64(42) {
+        t.Errorf("got %#v after skipped key, expected 42", v)
+    }
+}
+
+func TestSkipKeysNested(t *testing.T) {
+    data := "d1:ad1:bli1e2:xyd1:ci-3eeee1:c3:fooe"
+
+    dec := bencode.NewDecoder(strings.NewReader(data))
+    dec.SkipKeys("a")
+
+    v, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+    expected := map[string]interface{}{"c": "foo"}
+    if !reflect.DeepEqual(v, expected) {
+        t.Errorf("got %#v, expected %#v", v, expected)
+    }
+
+    for _, bad := range []string{"d1:a3:xxe", "d1:ali1e", "d1:aie1:bi1ee",
+        "d1:ax1:bi1ee"} {
+        dec := bencode.NewDecoder(strings.NewReader(bad))
+        dec.SkipKeys("a")
+        if _, err := dec.Decode(); err == nil {
+            t.Errorf("expected error decoding %q", bad)
+        }
+    }
+}
+
+func TestSkipKeysLarge(t *testing.T) {
+    const size = 64 << 20
+
+    r := io.MultiReader(
+        strings.NewReader(fmt.Sprintf("d4:name4:test6:pieces%d:", size)),
+        io.LimitReader(repeat_reader('x'), size),
+        strings.NewReader("e"),
+    )
+    dec := bencode.NewDecoder(r)
+    dec.SkipKeys("pieces")
+
+    var before, after runtime.MemStats
+    runtime.ReadMemStats(&before)
+
+    v, err := dec.Decode()
+    if err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    runtime.ReadMemStats(&after)
+    if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size / 4 {
+        t.Errorf("allocated %d bytes skipping a %d byte string", alloc, size)
+    }
+
+    expected := map[string]interface{}{"name": "test"}
+    if !reflect.DeepEqual(v, expected) {
+        t.Errorf("got %#v, expected %#v", v, expected)
+    }
+}
@@ -0,0 +1,318 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+)
+
+// A list or dictionary opened with StartList() or StartDict() and not yet
+// closed with End().
+type stream_frame struct {
+    is_dict bool
+    // a key has been written and awaits its value
+    has_key bool
+    // the last key written, for checking the order of keys
+    last_key string
+    keys int
+    // entries of a dictionary being buffered for sorting, and the Writer to
+    // write it to once it's closed
+    entries []*stream_entry
+    out io.Writer
+    // keys of the buffered entries, for detecting duplicates
+    seen map[string]struct{}
+    // the value for the key written is to be redacted
+    redact bool
+    // elements written to a list, for the path passed to the key hook
+    elems int
+    // the container is an element or value within another, so it has an
+    // entry in the Encoder's path
+    nested bool
+    // the Writer to go back to when closing a container written as the value
+    // of a redacted key, whose contents are discarded
+    discard_out io.Writer
+}
+
+// A buffered dictionary entry.
+type stream_entry struct {
+    key string
+    value bytes.Buffer
+}
+
+// Cause dictionaries written with StartDict() to be buffered in memory and
+// their keys sorted when End() is called, instead of requiring the keys to
+// be written in sorted order. Keys must still be unique.
+func (enc *Encoder) SortStreamKeys() {
+    enc.sort_stream = true
+}
+
+// Start writing a dictionary incrementally, e.g., to produce a large
+// document without building it in memory first. Write each entry with
+// WriteKey() followed by WriteValue(), StartDict(), or StartList(), then
+// close the dictionary with End(). For example, to write
+// "d4:infod6:lengthi5ee4:name1:xe":
+//
+//     enc.StartDict()
+//     enc.WriteKey("info")
+//     enc.StartDict()
+//     enc.WriteKey("length")
+//     enc.WriteValue(5)
+//     enc.End()
+//     enc.WriteKey("name")
+//     enc.WriteValue("x")
+//     enc.End()
+//
+// Keys must be written in canonical (byte-wise sorted) order, unless
+// SortStreamKeys() has been called. An error is returned, and nothing
+// written, for a key that is out of order or repeated, or for a value that
+// is not allowed at this point, e.g., inside a dictionary without a
+// preceding key.
+func (enc *Encoder) StartDict() error {
+    return enc.start_container('d')
+}
+
+// Start writing a list incrementally. Write each element with WriteValue(),
+// StartDict(), or StartList(), then close the list with End(). See
+// StartDict().
+func (enc *Encoder) StartList() error {
+    return enc.start_container('l')
+}
+
+// Write a dictionary key inside a dictionary opened with StartDict(). It
+// must be followed by its value before the next key. As with Encode(), the
+// key hook set with SetKeyHook() is called for the key, and the value of a
+// key passed to Redact() is replaced by the placeholder, including a whole
+// list or dictionary started as its value. Keys of dictionaries buffered due
+// to SortStreamKeys() are passed to the key hook in the order written.
+func (enc *Encoder) WriteKey(key string) error {
+    top := enc.stream_top()
+    if top == nil || !top.is_dict {
+        return errors.New("key written outside of a dictionary")
+    }
+    if top.has_key {
+        return errors.New("key written where a value was expected")
+    }
+
+    if top.out != nil {
+        if _, ok := top.seen[key]; ok {
+            return fmt.Errorf("duplicate dictionary key %q", key)
+        }
+        top.seen[key] = struct{}{}
+
+        enc.stream_key(top, key)
+        e := &stream_entry{key: key}
+        top.entries = append(top.entries, e)
+        enc.w = &e.value
+
+        return nil
+    }
+
+    // strings compare as raw bytes
+    if top.keys > 0 && key <= top.last_key {
+        return fmt.Errorf("dictionary key %q written after key %q: keys " +
+            "must be unique and sorted", key, top.last_key)
+    }
+
+    if err := enc.write_string(key); err != nil {
+        return err
+    }
+    enc.stream_key(top, key)
+    top.keys++
+
+    return nil
+}
+
+// Account for a key written to the open dictionary, top, calling the key
+// hook and noting whether its value is to be redacted.
+func (enc *Encoder) stream_key(top *stream_frame, key string) {
+    if enc.key_hook != nil && !enc.stream_discarding() {
+        enc.key_hook(enc.path, key)
+    }
+
+    top.has_key = true
+    top.last_key = key
+    top.redact = enc.redacted[key]
+}
+
+// Report whether the open containers are within a redacted value.
+func (enc *Encoder) stream_discarding() bool {
+    for _, frame := range enc.stream {
+        if frame.discard_out != nil {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Write a complete value, as Encode() does, as the next element of the open
+// list, or as the value for the last key written in the open dictionary.
+func (enc *Encoder) WriteValue(v interface{}) error {
+    redact, err := enc.stream_value()
+    if err != nil {
+        return err
+    }
+    if redact {
+        v = enc.redact_placeholder
+    }
+
+    nested := len(enc.stream) > 0
+    if enc.stream_discarding() {
+        enc.pop_path()
+        return nil
+    }
+
+    err = enc.Encode(v)
+    if nested {
+        enc.pop_path()
+    }
+
+    return err
+}
+
+// Close the list or dictionary opened most recently with StartList() or
+// StartDict().
+func (enc *Encoder) End() error {
+    top := enc.stream_top()
+    if top == nil {
+        return errors.New("end written with no open list or dictionary")
+    }
+    if top.has_key {
+        return errors.New("dictionary closed after a key with no value")
+    }
+
+    enc.stream = enc.stream[:len(enc.stream) - 1]
+
+    var err error
+    switch {
+    case top.discard_out != nil:
+        enc.w = top.discard_out
+    case top.out != nil:
+        err = enc.write_sorted_entries(top)
+    default:
+        _, err = enc.w.Write([]byte{'e'})
+    }
+
+    if top.nested {
+        enc.pop_path()
+    }
+
+    return enc.flush(err)
+}
+
+// Write out a buffered dictionary with its keys sorted.
+func (enc *Encoder) write_sorted_entries(frame *stream_frame) error {
+    enc.w = frame.out
+
+    sort.Slice(frame.entries, func(i, j int) bool {
+        return frame.entries[i].key < frame.entries[j].key
+    })
+
+    for _, e := range frame.entries {
+        if err := enc.write_string(e.key); err != nil {
+            return err
+        }
+        if _, err := e.value.WriteTo(enc.w); err != nil {
+            return err
+        }
+    }
+
+    _, err := enc.w.Write([]byte{'e'})
+
+    return err
+}
+
+func (enc *Encoder) start_container(delim byte) error {
+    redact, err := enc.stream_value()
+    if err != nil {
+        return err
+    }
+    nested := len(enc.stream) > 0
+
+    if redact {
+        // write the placeholder, and discard the container's contents
+        if err := enc.write_string(enc.redact_placeholder); err != nil {
+            return err
+        }
+        enc.stream = append(enc.stream, &stream_frame{is_dict: delim == 'd',
+            nested: nested, discard_out: enc.w})
+        enc.w = io.Discard
+
+        return nil
+    }
+
+    if _, err := enc.w.Write([]byte{delim}); err != nil {
+        return err
+    }
+
+    frame := &stream_frame{is_dict: delim == 'd', nested: nested}
+    if frame.is_dict && enc.sort_stream {
+        frame.out = enc.w
+        frame.seen = make(map[string]struct{})
+    }
+    enc.stream = append(enc.stream, frame)
+
+    return nil
+}
+
+// Check that a value may be written next, and account for it in the open
+// list or dictionary, if any, adding it to the Encoder's path. Return
+// whether the value is to be redacted.
+func (enc *Encoder) stream_value() (bool, error) {
+    top := enc.stream_top()
+    if top == nil {
+        return false, nil
+    }
+
+    if !top.is_dict {
+        enc.push_path(strconv.Itoa(top.elems))
+        top.elems++
+        return false, nil
+    }
+
+    if !top.has_key {
+        return false, errors.New("value written in a dictionary without a key")
+    }
+    top.has_key = false
+    enc.push_path(top.last_key)
+
+    return top.redact, nil
+}
+
+// Return the innermost open list or dictionary, or nil if there is none.
+func (enc *Encoder) stream_top() *stream_frame {
+    if len(enc.stream) == 0 {
+        return nil
+    }
+
+    return enc.stream[len(enc.stream) - 1]
+}
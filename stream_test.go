@@ -0,0 +1,289 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "strings"
+    "testing"
+)
+
+func TestEncoderStreaming(t *testing.T) {
+    var buf bytes.Buffer
+    enc := bencode.NewEncoder(&buf)
+
+    steps := []func() error{
+        enc.StartDict,
+        func() error { return enc.WriteKey("announce") },
+        func() error { return enc.WriteValue("http://tracker") },
+        func() error { return enc.WriteKey("info") },
+        enc.StartDict,
+        func() error { return enc.WriteKey("files") },
+        enc.StartList,
+        func() error {
+            return enc.WriteValue(map[string]interface{}{"length": 5})
+        },
+        enc.StartDict,
+        func() error { return enc.WriteKey("length") },
+        func() error { return enc.WriteValue(int64(7)) },
+        enc.End,
+        enc.End,
+        func() error { return enc.WriteKey("name") },
+        func() error { return enc.WriteValue([]byte("x")) },
+        enc.End,
+        func() error { return enc.WriteKey("list") },
+        enc.StartList,
+        enc.End,
+        enc.End,
+    }
+    for i, step := range steps {
+        if err := step(); err != nil {
+            t.Fatalf("step %d: %s", i, err)
+        }
+    }
+
+    expected, err := bencode.EncodeToString(map[string]interface{}{
+        "announce": "http://tracker",
+        "info": map[string]interface{}{
+            "files": []interface{}{
+                map[string]interface{}{"length": 5},
+                map[string]interface{}{"length": 7},
+            },
+            "name": "x",
+        },
+        "list": []interface{}{},
+    })
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if buf.String() != expected {
+        t.Errorf("got %q, expected %q", buf.String(), expected)
+    }
+}
+
+func TestEncoderStreamingNesting(t *testing.T) {
+    tests := map[string]func(enc *bencode.Encoder) error{
+        "end without start": func(enc *bencode.Encoder) error {
+            return enc.End()
+        },
+        "key outside dict": func(enc *bencode.Encoder) error {
+            enc.StartList()
+            return enc.WriteKey("a")
+        },
+        "key at top level": func(enc *bencode.Encoder) error {
+            return enc.WriteKey("a")
+        },
+        "end after key": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            enc.WriteKey("a")
+            return enc.End()
+        },
+        "two keys": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            enc.WriteKey("a")
+            return enc.WriteKey("b")
+        },
+        "value without key": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            return enc.WriteValue(1)
+        },
+        "list without key": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            return enc.StartList()
+        },
+        "second value": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            enc.WriteKey("a")
+            enc.WriteValue(1)
+            return enc.WriteValue(2)
+        },
+        "unsorted keys": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            enc.WriteKey("b")
+            enc.WriteValue(1)
+            return enc.WriteKey("a")
+        },
+        "unsorted binary keys": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            enc.WriteKey("\x80")
+            enc.WriteValue(1)
+            return enc.WriteKey("\x7f")
+        },
+        "duplicate keys": func(enc *bencode.Encoder) error {
+            enc.StartDict()
+            enc.WriteKey("a")
+            enc.WriteValue(1)
+            return enc.WriteKey("a")
+        },
+        "duplicate buffered keys": func(enc *bencode.Encoder) error {
+            enc.SortStreamKeys()
+            enc.StartDict()
+            enc.WriteKey("b")
+            enc.WriteValue(1)
+            enc.WriteKey("a")
+            enc.WriteValue(1)
+            return enc.WriteKey("b")
+        },
+        "extra end": func(enc *bencode.Encoder) error {
+            enc.StartList()
+            enc.End()
+            return enc.End()
+        },
+    }
+
+    for name, test := range tests {
+        var buf bytes.Buffer
+        enc := bencode.NewEncoder(&buf)
+        if err := test(enc); err == nil {
+            t.Errorf("%s: expected error", name)
+        }
+    }
+}
+
+func TestEncoderStreamingSortKeys(t *testing.T) {
+    var buf bytes.Buffer
+    enc := bencode.NewEncoder(&buf)
+    enc.SortStreamKeys()
+
+    steps := []func() error{
+        enc.StartList,
+        enc.StartDict,
+        func() error { return enc.WriteKey("z") },
+        enc.StartDict,
+        func() error { return enc.WriteKey("y") },
+        func() error { return enc.WriteValue(2) },
+        func() error { return enc.WriteKey("x") },
+        enc.StartList,
+        func() error {
+            return enc.WriteValue(map[string]int64{"b": 1, "a": 0})
+        },
+        enc.End,
+        enc.End,
+        func() error { return enc.WriteKey("\xff") },
+        func() error { return enc.WriteValue("high") },
+        func() error { return enc.WriteKey("a") },
+        func() error { return enc.WriteValue("") },
+        enc.End,
+        func() error { return enc.WriteValue(int64(3)) },
+        enc.End,
+    }
+    for i, step := range steps {
+        if err := step(); err != nil {
+            t.Fatalf("step %d: %s", i, err)
+        }
+    }
+
+    expected := "ld1:a0:1:zd1:xld1:ai0e1:bi1eee1:yi2ee1:\xff4:highei3ee"
+    if buf.String() != expected {
+        t.Errorf("got %q, expected %q", buf.String(), expected)
+    }
+    if ok, err := bencode.IsCanonical(buf.Bytes()); !ok {
+        t.Errorf("output is not canonical: %s", err)
+    }
+}
+
+func TestEncoderStreamingFlush(t *testing.T) {
+    var out strings.Builder
+    enc := bencode.NewEncoder(&out)
+
+    enc.StartList()
+    enc.WriteValue("spam")
+    enc.StartDict()
+    enc.WriteKey("a")
+    enc.WriteValue(int64(1))
+    enc.End()
+    if out.Len() != 0 {
+        t.Errorf("got %q before the outer list was closed", out.String())
+    }
+
+    if err := enc.Flush(); err != nil {
+        t.Fatalf("error flushing: %s", err)
+    }
+    if got := out.String(); got != "l4:spamd1:ai1ee" {
+        t.Errorf("got %q after Flush()", got)
+    }
+
+    if err := enc.End(); err != nil {
+        t.Fatalf("error closing list: %s", err)
+    }
+    if got := out.String(); got != "l4:spamd1:ai1eee" {
+        t.Errorf("got %q after closing the list", got)
+    }
+}
+
+// Write {"announce": "http://t/passkey", "info": {"files": [{"path": "a"}],
+// "name": "x"}, "private": {"key": "s"}} with the streaming API.
+func write_streamed_torrent(enc *bencode.Encoder) {
+    enc.StartDict()
+    enc.WriteKey("announce")
+    enc.WriteValue("http://t/passkey")
+    enc.WriteKey("info")
+    enc.StartDict()
+    enc.WriteKey("files")
+    enc.StartList()
+    enc.StartDict()
+    enc.WriteKey("path")
+    enc.WriteValue("a")
+    enc.End()
+    enc.End()
+    enc.WriteKey("name")
+    enc.WriteValue("x")
+    enc.End()
+    enc.WriteKey("private")
+    enc.StartDict()
+    enc.WriteKey("key")
+    enc.WriteValue("s")
+    enc.End()
+    enc.End()
+}
+
+func TestEncoderStreamingRedactAndKeyHook(t *testing.T) {
+    torrent := map[string]interface{}{
+        "announce": "http://t/passkey",
+        "info": map[string]interface{}{
+            "files": []interface{}{map[string]interface{}{"path": "a"}},
+            "name": "x",
+        },
+        "private": map[string]interface{}{"key": "s"},
+    }
+
+    for _, sorted := range []bool{false, true} {
+        setup := func(enc *bencode.Encoder, keys *[]string) {
+            enc.Redact("REDACTED", "announce", "private")
+            enc.SetKeyHook(func(path []string, key string) {
+                *keys = append(*keys, strings.Join(append(path, key), "/"))
+            })
+            if sorted {
+                enc.SortStreamKeys()
+            }
+        }
+
+        var expected strings.Builder
+        var expected_keys []string
+        enc := bencode.NewEncoder(&expected)
+        setup(enc, &expected_keys)
+        if err := enc.Encode(torrent); err != nil {
+            t.Fatalf("error encoding: %s", err)
+        }
+
+        var got strings.Builder
+        var got_keys []string
+        enc = bencode.NewEncoder(&got)
+        setup(enc, &got_keys)
+        write_streamed_torrent(enc)
+
+        if got.String() != expected.String() {
+            t.Errorf("sorted %t: got %q, expected %q", sorted, got.String(),
+                expected.String())
+        }
+        if !strings.Contains(got.String(), "8:announce8:REDACTED") ||
+            !strings.Contains(got.String(), "7:private8:REDACTEDe") {
+
+            t.Errorf("sorted %t: values not redacted in %q", sorted,
+                got.String())
+        }
+        if strings.Join(got_keys, " ") != strings.Join(expected_keys, " ") {
+            t.Errorf("sorted %t: got keys %v, expected %v", sorted, got_keys,
+                expected_keys)
+        }
+    }
+}
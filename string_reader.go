@@ -0,0 +1,134 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "bytes"
+    "io"
+)
+
+// Reads the contents of a byte string directly from the Decoder's input.
+type string_reader struct {
+    dec *Decoder
+    remaining int64
+}
+
+// Read the next token, which must be a byte string, and return an io.Reader
+// over its contents along with its declared length. The contents are read
+// from the input as the returned Reader is read, rather than being held in
+// memory, so large values, e.g., piece data, can be copied straight to a
+// file. The maximum set with SetMaxStringLen() does not apply.
+//
+// The returned Reader is only valid until the next call to Token(),
+// Decode(), or StringReader(). Any part of the string not read by then is
+// skipped, so the Decoder continues with the value following the string.
+// If the next token is not a byte string, an error is returned and nothing
+// is consumed.
+func (dec *Decoder) StringReader() (io.Reader, int64, error) {
+    if dec.peeked != nil {
+        return dec.peeked_string_reader()
+    }
+
+    if err := dec.skip_string_reader(); err != nil {
+        return nil, 0, err
+    }
+
+    b, err := dec.r.Peek(1)
+    if err != nil {
+        return nil, 0, err
+    }
+    if b[0] < '0' || b[0] > '9' {
+        return nil, 0, syntax_error(dec.r.Tell(), "expected a byte string " +
+            "at byte %d, found %q", dec.r.Tell(), b[0])
+    }
+
+    size, err := dec.get_string_len()
+    if err != nil {
+        return nil, 0, err
+    }
+
+    dec.str_reader = &string_reader{dec: dec, remaining: size}
+
+    return dec.str_reader, size, nil
+}
+
+func (sr *string_reader) Read(p []byte) (int, error) {
+    if sr.remaining <= 0 {
+        return 0, io.EOF
+    }
+    if int64(len(p)) > sr.remaining {
+        p = p[:sr.remaining]
+    }
+
+    n, err := sr.dec.r.Read(p)
+    sr.remaining -= int64(n)
+    if err == io.EOF && sr.remaining > 0 {
+        err = io.ErrUnexpectedEOF
+    }
+
+    return n, err
+}
+
+// Discard whatever is left of the string returned by StringReader(), if any.
+func (dec *Decoder) skip_string_reader() error {
+    sr := dec.str_reader
+    if sr == nil {
+        return nil
+    }
+    dec.str_reader = nil
+
+    _, err := io.Copy(io.Discard, sr)
+
+    return err
+}
+
+// Return a Reader over a byte string that has already been read by Peek().
+func (dec *Decoder) peeked_string_reader() (io.Reader, int64, error) {
+    p := dec.peeked
+    if p.err != nil {
+        return nil, 0, p.err
+    }
+
+    token := p.token
+    if raw, ok := token.(RawScalar); ok {
+        token = raw.Value
+    }
+
+    var b []byte
+    switch val := token.(type) {
+    case string:
+        b = []byte(val)
+    case []byte:
+        b = val
+    default:
+        return nil, 0, syntax_error(p.start, "expected a byte string at " +
+            "byte %d, found %q", p.start, p.raw[0])
+    }
+
+    dec.peeked = nil
+
+    return bytes.NewReader(b), int64(len(b)), nil
+}
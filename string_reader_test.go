@@ -0,0 +1,112 @@
+package bencode_test
+
+import (
+    "bytes"
+    "fmt"
+    bencode "github.com/cuberat/go-bencode"
+    "io"
+    "runtime"
+    "strings"
+    "testing"
+)
+
+// Produces an endless stream of the same byte.
+type repeat_reader byte
+
+func (r repeat_reader) Read(p []byte) (int, error) {
+    for i := range p {
+        p[i] = byte(r)
+    }
+
+    return len(p), nil
+}
+
+func TestStringReaderLarge(t *testing.T) {
+    const size = 64 << 20
+
+    r := io.MultiReader(
+        strings.NewReader(fmt.Sprintf("d6:pieces%d:", size)),
+        io.LimitReader(repeat_reader('x'), size),
+        strings.NewReader("4:name4:teste"),
+    )
+    dec := bencode.NewDecoder(r)
+
+    if token, err := dec.Token(); err != nil || token != bencode.Delim('d') {
+        t.Fatalf("got %v, %v, expected dict start", token, err)
+    }
+    if token, err := dec.Token(); err != nil || token != "pieces" {
+        t.Fatalf("got %v, %v, expected key", token, err)
+    }
+
+    var before, after runtime.MemStats
+    runtime.ReadMemStats(&before)
+
+    sr, length, err := dec.StringReader()
+    if err != nil {
+        t.Fatalf("error getting string reader: %s", err)
+    }
+    if length != size {
+        t.Errorf("got length %d, expected %d", length, size)
+    }
+
+    n, err := io.Copy(io.Discard, sr)
+    if err != nil {
+        t.Fatalf("error copying string: %s", err)
+    }
+    if n != size {
+        t.Errorf("copied %d bytes, expected %d", n, size)
+    }
+
+    runtime.ReadMemStats(&after)
+    if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size / 4 {
+        t.Errorf("allocated %d bytes streaming a %d byte string", allocated,
+            size)
+    }
+
+    for _, expected := range []bencode.Token{"name", "test",
+        bencode.Delim('e')} {
+
+        token, err := dec.Token()
+        if err != nil || token != expected {
+            t.Errorf("got %v, %v, expected %v", token, err, expected)
+        }
+    }
+}
+
+func TestStringReaderPartial(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("l5:helloi3ee"))
+    dec.Token()
+
+    sr, _, err := dec.StringReader()
+    if err != nil {
+        t.Fatalf("error getting string reader: %s", err)
+    }
+
+    buf := make([]byte, 2)
+    if _, err := io.ReadFull(sr, buf); err != nil || !bytes.Equal(buf,
+        []byte("he")) {
+        t.Fatalf("got %q, %v", buf, err)
+    }
+
+    // the rest of the string is skipped
+    if token, err := dec.Token(); err != nil || token != int64(3) {
+        t.Errorf("got %v, %v, expected 3", token, err)
+    }
+
+    if _, _, err := dec.StringReader(); err == nil {
+        t.Errorf("expected an error for a non-string token")
+    }
+}
+
+func TestStringReaderTruncated(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader("10:abc"))
+
+    sr, _, err := dec.StringReader()
+    if err != nil {
+        t.Fatalf("error getting string reader: %s", err)
+    }
+
+    if _, err := io.Copy(io.Discard, sr); err != io.ErrUnexpectedEOF {
+        t.Errorf("got error %v, expected %v", err, io.ErrUnexpectedEOF)
+    }
+}
@@ -0,0 +1,116 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "reflect"
+    "time"
+)
+
+var time_type = reflect.TypeOf(time.Time{})
+
+// Set the unit used to encode time.Time values as integers, e.g.,
+// time.Millisecond to encode milliseconds since the Unix epoch. The default
+// is time.Second. Units shorter than a second must divide a second evenly.
+//
+// The unit may be overridden for a struct field with a tag option of unix,
+// unixmilli, unixmicro, or unixnano, e.g.,
+//
+//     Created time.Time `bencode:"creation date,unixnano"`
+func (enc *Encoder) SetTimeUnit(unit time.Duration) {
+    enc.time_unit = unit
+}
+
+// Set the unit used to decode integers into time.Time values with
+// DecodeInto(). This must match the unit the data was encoded with. The
+// default is time.Second.
+func (dec *Decoder) SetTimeUnit(unit time.Duration) {
+    dec.coercer.time_unit = unit
+}
+
+// Return the time unit selected by a struct tag option, if any: unix
+// (seconds), unixmilli, unixmicro, or unixnano.
+func (tag *field_tag) time_unit() (time.Duration, bool) {
+    switch {
+    case tag.has("unix"):
+        return time.Second, true
+    case tag.has("unixmilli"):
+        return time.Millisecond, true
+    case tag.has("unixmicro"):
+        return time.Microsecond, true
+    case tag.has("unixnano"):
+        return time.Nanosecond, true
+    }
+
+    return 0, false
+}
+
+// Convert t to an integer count of unit since the Unix epoch.
+func time_to_int(t time.Time, unit time.Duration) int64 {
+    if unit <= 0 {
+        unit = time.Second
+    }
+
+    if unit >= time.Second {
+        return t.Unix() / int64(unit / time.Second)
+    }
+
+    per_sec := int64(time.Second / unit)
+
+    return t.Unix() * per_sec + int64(t.Nanosecond()) / int64(unit)
+}
+
+// Convert an integer count of unit since the Unix epoch to a time.Time.
+func time_from_int(n int64, unit time.Duration) time.Time {
+    if unit <= 0 {
+        unit = time.Second
+    }
+
+    if unit >= time.Second {
+        return time.Unix(n * int64(unit / time.Second), 0)
+    }
+
+    per_sec := int64(time.Second / unit)
+
+    return time.Unix(n / per_sec, (n % per_sec) * int64(unit))
+}
+
+func (c *coercer) set_val_coerce_to_time(out *reflect.Value,
+    in reflect.Value) error {
+
+    if _, ok := get_int_kind(in.Kind()); !ok {
+        return unsupported_coercion(out, in)
+    }
+
+    tmp := reflect.New(reflect.TypeOf(int64(0))).Elem()
+    if err := c.set_val_coerce_to_int(&tmp, in); err != nil {
+        return err
+    }
+
+    out.Set(reflect.ValueOf(time_from_int(tmp.Int(), c.time_unit)))
+
+    return nil
+}
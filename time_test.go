@@ -0,0 +1,89 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "fmt"
+    "testing"
+    "time"
+)
+
+type Created struct {
+    Created time.Time
+}
+
+func TestTimeUnitRoundTrip(t *testing.T) {
+    when := time.Date(2020, 5, 17, 12, 30, 45, 123456789, time.UTC)
+
+    tests := []struct {
+        unit time.Duration
+        expected int64
+        truncated time.Time
+    }{
+        {time.Second, when.Unix(), when.Truncate(time.Second)},
+        {time.Millisecond, when.Unix() * 1000 + 123,
+            when.Truncate(time.Millisecond)},
+        {time.Microsecond, when.Unix() * 1000000 + 123456,
+            when.Truncate(time.Microsecond)},
+        {time.Nanosecond, when.UnixNano(), when},
+    }
+
+    for _, test := range tests {
+        buf := new(bytes.Buffer)
+        enc := bencode.NewEncoder(buf)
+        enc.SetTimeUnit(test.unit)
+
+        if err := enc.Encode(Created{when}); err != nil {
+            t.Fatalf("error encoding: %s", err)
+        }
+
+        expected := fmt.Sprintf("d7:Createdi%dee", test.expected)
+        if buf.String() != expected {
+            t.Errorf("got %q for unit %s, expected %q", buf.String(),
+                test.unit, expected)
+        }
+
+        var got Created
+        dec := bencode.NewDecoder(buf)
+        dec.SetTimeUnit(test.unit)
+        if err := dec.DecodeInto(&got); err != nil {
+            t.Fatalf("error decoding: %s", err)
+        }
+
+        if !got.Created.Equal(test.truncated) {
+            t.Errorf("got %s for unit %s, expected %s", got.Created, test.unit,
+                test.truncated)
+        }
+    }
+}
+
+func TestTimeTagRoundTrip(t *testing.T) {
+    type Torrent struct {
+        Created time.Time `bencode:"creation date"`
+        Updated time.Time `bencode:"updated,unixnano"`
+    }
+
+    in := Torrent{
+        Created: time.Unix(1589718645, 0),
+        Updated: time.Unix(1589718645, 123456789),
+    }
+
+    encoded, err := bencode.EncodeToString(in)
+    if err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    expected := "d13:creation datei1589718645e7:updatedi1589718645123456789ee"
+    if encoded != expected {
+        t.Errorf("got %q, expected %q", encoded, expected)
+    }
+
+    var got Torrent
+    if err := bencode.Unmarshal([]byte(encoded), &got); err != nil {
+        t.Fatalf("error decoding: %s", err)
+    }
+
+    if !got.Created.Equal(in.Created) || !got.Updated.Equal(in.Updated) {
+        t.Errorf("got %+v, expected %+v", got, in)
+    }
+}
@@ -0,0 +1,73 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "io"
+)
+
+// Read every remaining token from the input, calling fn with each one, as
+// returned by Token(), and the offset of its start, e.g., to index or lint a
+// document without decoding it. Concatenated top-level values are walked in
+// turn.
+//
+// Walking stops at the end of the input, returning nil, or at the first
+// error, which is returned. An error returned by fn is returned as-is. The
+// input ending inside a list or dictionary is an io.ErrUnexpectedEOF.
+func (dec *Decoder) Tokens(fn func(token Token, offset int64) error) error {
+    depth := 0
+
+    for {
+        if err := dec.skip_string_reader(); err != nil {
+            return err
+        }
+
+        offset := dec.InputOffset()
+        token, err := dec.Token()
+        if err == io.EOF && depth == 0 {
+            return nil
+        }
+        if err != nil {
+            return unexpected_eof(err)
+        }
+
+        switch token {
+        case Delim('l'), Delim('d'):
+            depth++
+        case Delim('e'):
+            if depth == 0 {
+                return syntax_error(uint64(offset), "unexpected end of " +
+                    "container at byte %d", offset)
+            }
+            depth--
+        }
+
+        if err := fn(token, offset); err != nil {
+            return err
+        }
+    }
+}
@@ -0,0 +1,90 @@
+package bencode_test
+
+import (
+    "errors"
+    bencode "github.com/cuberat/go-bencode"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+type offset_token struct {
+    token bencode.Token
+    offset int64
+}
+
+func TestTokens(t *testing.T) {
+    dec := bencode.NewDecoder(strings.NewReader(
+        "d4:listli1e2:abdee3:numi-7eei42e"))
+
+    var got []offset_token
+    err := dec.Tokens(func(token bencode.Token, offset int64) error {
+        got = append(got, offset_token{token, offset})
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("error walking tokens: %s", err)
+    }
+
+    expected := []offset_token{
+        {bencode.Delim('d'), 0},
+        {"list", 1},
+        {bencode.Delim('l'), 7},
+        {int64(1), 8},
+        {"ab", 11},
+        {bencode.Delim('d'), 15},
+        {bencode.Delim('e'), 16},
+        {bencode.Delim('e'), 17},
+        {"num", 18},
+        {int64(-7), 23},
+        {bencode.Delim('e'), 27},
+        {int64(42), 28},
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("got %v, expected %v", got, expected)
+    }
+}
+
+func TestTokensErrors(t *testing.T) {
+    walk := func(data string) (int, error) {
+        count := 0
+        dec := bencode.NewDecoder(strings.NewReader(data))
+        err := dec.Tokens(func(token bencode.Token, offset int64) error {
+            count++
+            return nil
+        })
+
+        return count, err
+    }
+
+    count, err := walk("li1ei2x")
+    var syntax_err *bencode.SyntaxError
+    if !errors.As(err, &syntax_err) {
+        t.Errorf("got error %v, expected a *SyntaxError", err)
+    }
+    if count != 2 {
+        t.Errorf("got %d tokens before the error, expected 2", count)
+    }
+
+    if _, err := walk("li1e"); err != io.ErrUnexpectedEOF {
+        t.Errorf("got error %v, expected io.ErrUnexpectedEOF", err)
+    }
+    if _, err := walk("i1ee"); err == nil {
+        t.Errorf("expected error for unmatched end")
+    }
+
+    stop := errors.New("stop")
+    dec := bencode.NewDecoder(strings.NewReader("li1ei2ee"))
+    count = 0
+    err = dec.Tokens(func(token bencode.Token, offset int64) error {
+        count++
+        if token == int64(1) {
+            return stop
+        }
+        return nil
+    })
+    if err != stop || count != 2 {
+        t.Errorf("got %v after %d tokens, expected stop after 2", err, count)
+    }
+}
@@ -0,0 +1,162 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package bencode
+
+import (
+    "fmt"
+    "io"
+)
+
+// States of a trace_writer between tokens and partway through them.
+const (
+    trace_idle = iota
+    trace_int
+    trace_str_len
+    trace_str_body
+)
+
+// Passes the encoded output through to w while following its tokens, and
+// writes a line describing each complete token to trace.
+type trace_writer struct {
+    w io.Writer
+    trace io.Writer
+    // offset in the output of the next byte written
+    pos int64
+    state int
+    // offset of the start of the token in progress
+    start int64
+    // digits of an integer or string length in progress
+    digits []byte
+    // bytes of the string in progress still to come
+    remaining int64
+}
+
+// Write a description of each token as it's written, e.g., for logging, to
+// trace: its kind, byte range in the output (from the start of the token up
+// to, but not including, the end), and the value of integers or length of
+// byte strings, e.g.,
+//
+//     [0, 1) dict
+//     [1, 7) string (4 bytes)
+//     [7, 11) int 42
+//     [11, 12) end
+//
+// Offsets count from the first byte written after SetTrace() or Reset()
+// is called. The Bencode output itself is unchanged. Passing a nil Writer
+// turns tracing off.
+func (enc *Encoder) SetTrace(trace io.Writer) {
+    if tw, ok := enc.w.(*trace_writer); ok {
+        enc.w = tw.w
+    }
+
+    if trace != nil {
+        enc.w = &trace_writer{w: enc.w, trace: trace}
+    }
+}
+
+func (tw *trace_writer) Write(p []byte) (int, error) {
+    n, err := tw.w.Write(p)
+    tw.follow(p[:n])
+
+    return n, err
+}
+
+// Advance through the bytes written, tracing each token completed.
+func (tw *trace_writer) follow(p []byte) {
+    for len(p) > 0 {
+        switch tw.state {
+        case trace_idle:
+            tw.start = tw.pos
+            b := p[0]
+            tw.advance(&p, 1)
+
+            switch {
+            case b == 'd':
+                tw.emit("dict")
+            case b == 'l':
+                tw.emit("list")
+            case b == 'e':
+                tw.emit("end")
+            case b == 'i':
+                tw.state = trace_int
+                tw.digits = tw.digits[:0]
+            case b >= '0' && b <= '9':
+                tw.state = trace_str_len
+                tw.digits = append(tw.digits[:0], b)
+            default:
+                tw.emit(fmt.Sprintf("unexpected byte %q", b))
+            }
+
+        case trace_int, trace_str_len:
+            b := p[0]
+            tw.advance(&p, 1)
+
+            if tw.state == trace_int && b == 'e' {
+                tw.state = trace_idle
+                tw.emit("int " + string(tw.digits))
+            } else if tw.state == trace_str_len && b == ':' {
+                tw.remaining = 0
+                for _, d := range tw.digits {
+                    tw.remaining = tw.remaining * 10 + int64(d - '0')
+                }
+                tw.state = trace_str_body
+                tw.finish_string()
+            } else {
+                tw.digits = append(tw.digits, b)
+            }
+
+        case trace_str_body:
+            n := int64(len(p))
+            if n > tw.remaining {
+                n = tw.remaining
+            }
+            tw.advance(&p, n)
+            tw.remaining -= n
+            tw.finish_string()
+        }
+    }
+}
+
+// Consume n bytes of p.
+func (tw *trace_writer) advance(p *[]byte, n int64) {
+    *p = (*p)[n:]
+    tw.pos += n
+}
+
+// Trace the byte string in progress if all of it has been written.
+func (tw *trace_writer) finish_string() {
+    if tw.remaining > 0 {
+        return
+    }
+
+    tw.state = trace_idle
+    tw.emit(fmt.Sprintf("string (%s bytes)", tw.digits))
+}
+
+func (tw *trace_writer) emit(desc string) {
+    fmt.Fprintf(tw.trace, "[%d, %d) %s\n", tw.start, tw.pos, desc)
+}
@@ -0,0 +1,62 @@
+package bencode_test
+
+import (
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "strings"
+    "testing"
+)
+
+func TestEncoderTrace(t *testing.T) {
+    var out, trace bytes.Buffer
+    enc := bencode.NewEncoder(&out)
+    enc.SetTrace(&trace)
+
+    v := map[string]interface{}{
+        "name": "spam",
+        "list": []interface{}{int64(-3), ""},
+    }
+    if err := enc.Encode(v); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+
+    if out.String() != "d4:listli-3e0:e4:name4:spame" {
+        t.Errorf("got output %q", out.String())
+    }
+
+    expected := strings.Join([]string{
+        "[0, 1) dict",
+        "[1, 7) string (4 bytes)",
+        "[7, 8) list",
+        "[8, 12) int -3",
+        "[12, 14) string (0 bytes)",
+        "[14, 15) end",
+        "[15, 21) string (4 bytes)",
+        "[21, 27) string (4 bytes)",
+        "[27, 28) end",
+    }, "\n") + "\n"
+    if trace.String() != expected {
+        t.Errorf("got trace:\n%s\nexpected:\n%s", trace.String(), expected)
+    }
+
+    // the trace is kept across a reset, with offsets starting over
+    out.Reset()
+    trace.Reset()
+    enc.Reset(&out)
+    if err := enc.Encode(int64(7)); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if trace.String() != "[0, 3) int 7\n" {
+        t.Errorf("got trace %q after reset", trace.String())
+    }
+
+    trace.Reset()
+    enc.SetTrace(nil)
+    if err := enc.Encode("x"); err != nil {
+        t.Fatalf("error encoding: %s", err)
+    }
+    if trace.Len() != 0 || out.String() != "i7e1:x" {
+        t.Errorf("got trace %q, output %q with tracing off", trace.String(),
+            out.String())
+    }
+}
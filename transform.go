@@ -0,0 +1,232 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "fmt"
+    "io"
+    "strconv"
+)
+
+// A TransformFunc is called by Transform() for each value in the input. The
+// path holds the dictionary keys and list indices (in decimal) leading to
+// the value, and v is the token starting the value: a string, an int64, or
+// a Delim ('l' or 'd') for a list or dictionary.
+//
+// Return the token to write in its place and true to keep the value, or
+// false to drop it (along with its key, if it is a dictionary value).
+// Returning the same Delim for a list or dictionary continues into it;
+// returning a string or integer instead replaces the whole container.
+//
+// The path slice is reused, so copy it if it needs to be retained.
+type TransformFunc func(path []string, v Token) (Token, bool)
+
+type transformer struct {
+    dec *Decoder
+    enc *Encoder
+    fn TransformFunc
+    // path to the value being transformed
+    path []string
+}
+
+// Stream the Bencode value on the Reader, r, to the Writer, w, calling fn
+// for each value along the way so that it may be rewritten or dropped. Only
+// one container is held open at a time, so this is suitable for editing
+// large documents, e.g., stripping a key from a torrent, without decoding
+// them into memory. Lists and dictionaries nested more than DefaultMaxDepth
+// deep are an error, as when decoding.
+func Transform(r io.Reader, w io.Writer, fn TransformFunc) error {
+    t := &transformer{dec: NewDecoder(r), enc: NewEncoder(w), fn: fn,
+        path: []string{}}
+
+    token, err := t.dec.Token()
+    if err != nil {
+        return err
+    }
+
+    return t.enc.flush(t.transform_value(token, nil))
+}
+
+func (t *transformer) transform_value(token Token, key *string) error {
+    path := t.path
+
+    if token == Delim('e') {
+        return syntax_error(t.dec.r.Tell(), "unexpected end of container " +
+            "at byte %d", t.dec.r.Tell())
+    }
+
+    new_token, keep := t.fn(path, token)
+    if !keep {
+        return t.dec.skip_value(token)
+    }
+
+    if key != nil {
+        if err := t.enc.encode(*key); err != nil {
+            return err
+        }
+    }
+
+    delim, is_delim := token.(Delim)
+    new_delim, new_is_delim := new_token.(Delim)
+    if new_is_delim && (!is_delim || new_delim != delim) {
+        return fmt.Errorf("can't replace value at %v with delimiter %q",
+            path, byte(new_delim))
+    }
+
+    if !is_delim {
+        return t.enc.encode(new_token)
+    }
+
+    if !new_is_delim {
+        // the whole container is being replaced
+        if err := t.enc.encode(new_token); err != nil {
+            return err
+        }
+        return t.dec.skip_value(token)
+    }
+
+    // nested lists and dictionaries are limited as when decoding
+    dec := t.dec
+    dec.depth++
+    defer func() { dec.depth-- }()
+
+    if dec.max_depth > 0 && dec.depth > dec.max_depth {
+        return syntax_error(dec.r.Tell(), "exceeded maximum nesting depth " +
+            "of %d at byte %d", dec.max_depth, dec.r.Tell())
+    }
+
+    if delim == 'l' {
+        return t.transform_list()
+    }
+
+    return t.transform_dict()
+}
+
+// Transform the value started by token, with elem added to the path.
+func (t *transformer) transform_child(elem string, token Token,
+    key *string) error {
+
+    t.path = append(t.path, elem)
+    err := t.transform_value(token, key)
+    t.path = t.path[:len(t.path) - 1]
+
+    return err
+}
+
+func (t *transformer) transform_list() error {
+    if _, err := t.enc.w.Write([]byte{'l'}); err != nil {
+        return err
+    }
+
+    for i := 0; ; i++ {
+        token, err := t.dec.Token()
+        if err != nil {
+            return unexpected_eof(err)
+        }
+        if token == Delim('e') {
+            break
+        }
+
+        if err := t.transform_child(strconv.Itoa(i), token, nil);
+            err != nil {
+            return err
+        }
+    }
+
+    _, err := t.enc.w.Write([]byte{'e'})
+
+    return err
+}
+
+func (t *transformer) transform_dict() error {
+    if _, err := t.enc.w.Write([]byte{'d'}); err != nil {
+        return err
+    }
+
+    for {
+        token, err := t.dec.Token()
+        if err != nil {
+            return unexpected_eof(err)
+        }
+        if token == Delim('e') {
+            break
+        }
+
+        key, ok := token.(string)
+        if !ok {
+            return syntax_error(t.dec.r.Tell(), "invalid type for " +
+                "dictionary key at byte %d.  must be a string.",
+                t.dec.r.Tell())
+        }
+
+        token, err = t.dec.Token()
+        if err != nil {
+            return unexpected_eof(err)
+        }
+
+        if err := t.transform_child(key, token, &key); err != nil {
+            return err
+        }
+    }
+
+    _, err := t.enc.w.Write([]byte{'e'})
+
+    return err
+}
+
+// Consume the rest of the value started by token, discarding it.
+func (dec *Decoder) skip_value(token Token) error {
+    depth := 0
+
+    for {
+        switch token {
+        case Delim('l'), Delim('d'):
+            depth++
+        case Delim('e'):
+            depth--
+        }
+
+        if depth <= 0 {
+            return nil
+        }
+
+        var err error
+        token, err = dec.Token()
+        if err != nil {
+            return unexpected_eof(err)
+        }
+    }
+}
+
+// Convert an io.EOF encountered in the middle of a value to
+// io.ErrUnexpectedEOF.
+func unexpected_eof(err error) error {
+    if err == io.EOF {
+        return io.ErrUnexpectedEOF
+    }
+
+    return err
+}
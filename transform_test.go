@@ -0,0 +1,99 @@
+package bencode_test
+
+import (
+    "bufio"
+    "bytes"
+    bencode "github.com/cuberat/go-bencode"
+    "errors"
+    "io"
+    "strings"
+    "testing"
+)
+
+func TestTransformDropKey(t *testing.T) {
+    in := "d8:announce3:url4:infod6:lengthi10e4:name4:spam" +
+        "6:piecesl1:a1:beee"
+    expected := "d8:announce3:url4:infod6:lengthi10e4:name4:spamee"
+
+    buf := new(bytes.Buffer)
+    err := bencode.Transform(strings.NewReader(in), buf,
+        func(path []string, v bencode.Token) (bencode.Token, bool) {
+            if len(path) == 2 && path[0] == "info" && path[1] == "pieces" {
+                return nil, false
+            }
+            return v, true
+        })
+    if err != nil {
+        t.Fatalf("error transforming: %s", err)
+    }
+
+    if got := buf.String(); got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+}
+
+func TestTransformRewrite(t *testing.T) {
+    in := "d8:announce3:url4:listli1ei2eee"
+    expected := "d8:announce9:other-url4:listli1ei20eee"
+
+    buf := new(bytes.Buffer)
+    err := bencode.Transform(strings.NewReader(in), buf,
+        func(path []string, v bencode.Token) (bencode.Token, bool) {
+            if len(path) == 1 && path[0] == "announce" {
+                return "other-url", true
+            }
+            if len(path) == 2 && path[1] == "1" {
+                return v.(int64) * 10, true
+            }
+            return v, true
+        })
+    if err != nil {
+        t.Fatalf("error transforming: %s", err)
+    }
+
+    if got := buf.String(); got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+}
+
+func keep_all(path []string, v bencode.Token) (bencode.Token, bool) {
+    return v, true
+}
+
+func TestTransformMaxDepth(t *testing.T) {
+    depth := bencode.DefaultMaxDepth
+    ok := strings.Repeat("l", depth) + strings.Repeat("e", depth)
+    var out bytes.Buffer
+    if err := bencode.Transform(strings.NewReader(ok), &out, keep_all);
+        err != nil {
+        t.Fatalf("error transforming %d nested lists: %s", depth, err)
+    }
+    if out.String() != ok {
+        t.Errorf("got %q", out.String())
+    }
+
+    deep := strings.Repeat("l", 10000) + strings.Repeat("e", 10000)
+    err := bencode.Transform(strings.NewReader(deep), io.Discard, keep_all)
+    var syntax_err *bencode.SyntaxError
+    if !errors.As(err, &syntax_err) ||
+        !strings.Contains(err.Error(), "maximum nesting depth") {
+
+        t.Errorf("got error %v for 10000 nested lists", err)
+    }
+}
+
+func TestTransformWriteError(t *testing.T) {
+    write_err := errors.New("broken pipe")
+    in := "d4:listli1ei2ee4:name4:spame"
+
+    // a one-byte bufio.Writer is used as is, so the writes fail directly
+    // rather than when the output is flushed
+    for _, w := range []io.Writer{&slow_writer{err: write_err},
+        bufio.NewWriterSize(&slow_writer{err: write_err}, 1)} {
+
+        err := bencode.Transform(strings.NewReader(in), w, keep_all)
+        if !errors.Is(err, write_err) {
+            t.Errorf("%T: got error %v, expected the write error", w, err)
+        }
+    }
+}
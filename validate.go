@@ -0,0 +1,135 @@
+// BSD 2-Clause License
+//
+// Copyright (c) 2017,2020 Don Owens <don@regexguy.com>.  All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// * Redistributions of source code must retain the above copyright notice, this
+//   list of conditions and the following disclaimer.
+//
+// * Redistributions in binary form must reproduce the above copyright notice,
+//   this list of conditions and the following disclaimer in the documentation
+//   and/or other materials provided with the distribution.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bencode
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+)
+
+// State of a list or dictionary that is open while validating.
+type validate_frame struct {
+    is_dict bool
+    // number of keys and values seen so far in a dictionary
+    items int
+    last_key string
+}
+
+// Check that the Reader, r, holds exactly one well-formed Bencode value:
+// delimiters are balanced, integers and string lengths are valid, and
+// dictionary keys are byte strings in strictly increasing order. This streams
+// through the tokens without building the decoded data structure. The error
+// returned describes the first problem found, including its byte offset.
+func Validate(r io.Reader) error {
+    return validate(NewDecoder(r), false)
+}
+
+// Validate the input read by dec. If canonical is true, integers and string
+// lengths must also be written exactly as the Encoder would write them.
+func validate(dec *Decoder, canonical bool) error {
+    if canonical {
+        dec.PreserveRaw()
+    }
+    stack := make([]*validate_frame, 0)
+
+    for {
+        start := dec.r.Tell()
+        token, err := dec.Token()
+        if err == io.EOF {
+            return syntax_error(dec.r.Tell(), "unexpected end of input at " +
+                "byte %d", dec.r.Tell())
+        }
+        if err != nil {
+            return &SyntaxError{msg: fmt.Sprintf("invalid token starting " +
+                "at byte %d: %s", start, err), err: err, Offset: int64(start)}
+        }
+
+        if raw, ok := token.(RawScalar); ok {
+            if err := check_canonical_scalar(raw, start); err != nil {
+                return err
+            }
+            token = raw.Value
+        }
+
+        var top *validate_frame
+        if len(stack) > 0 {
+            top = stack[len(stack) - 1]
+        }
+
+        if token == Delim('e') {
+            if top == nil {
+                return syntax_error(dec.r.Tell() - 1, "unexpected end of " +
+                    "container at byte %d", dec.r.Tell() - 1)
+            }
+            if top.is_dict && (top.items & 1) != 0 {
+                return syntax_error(dec.r.Tell() - 1, "dictionary key %q " +
+                    "has no value at byte %d", top.last_key, dec.r.Tell() - 1)
+            }
+            stack = stack[:len(stack) - 1]
+        } else {
+            if top != nil && top.is_dict && (top.items & 1) == 0 {
+                key, ok := token.(string)
+                if !ok {
+                    return syntax_error(dec.r.Tell(), "invalid dictionary " +
+                        "key before byte %d: must be a string", dec.r.Tell())
+                }
+                if top.items > 0 && key <= top.last_key {
+                    return &SyntaxError{msg: fmt.Sprintf("dictionary key " +
+                        "%q at byte %d is not sorted after key %q", key,
+                        start, top.last_key), err: ErrNotCanonical,
+                        Offset: int64(start)}
+                }
+                top.last_key = key
+            }
+            if top != nil {
+                top.items++
+            }
+
+            if delim, ok := token.(Delim); ok {
+                stack = append(stack, &validate_frame{is_dict: delim == 'd'})
+            }
+        }
+
+        if len(stack) == 0 {
+            break
+        }
+    }
+
+    err := dec.check_eof()
+    if se, ok := err.(*SyntaxError); ok && canonical {
+        // the value itself is well-formed
+        se.err = ErrNotCanonical
+    }
+
+    return err
+}
+
+// Check that data holds exactly one well-formed Bencode value. See
+// Validate().
+func ValidateBytes(data []byte) error {
+    return Validate(bytes.NewReader(data))
+}
@@ -0,0 +1,40 @@
+package bencode_test
+
+import (
+    bencode "github.com/cuberat/go-bencode"
+    "strings"
+    "testing"
+)
+
+func TestValidate(t *testing.T) {
+    valid := "d4:infod6:lengthi10e4:name1:ae4:listli1e1:xdeee"
+    if err := bencode.Validate(strings.NewReader(valid)); err != nil {
+        t.Errorf("unexpected error validating %q: %s", valid, err)
+    }
+}
+
+func TestValidateMalformed(t *testing.T) {
+    tests := map[string]string{
+        "empty": "",
+        "truncated list": "li1e",
+        "truncated string": "5:abc",
+        "bad integer": "i1x2e",
+        "integer key": "di1ei2ee",
+        "unsorted keys": "d1:bi1e1:ai2ee",
+        "duplicate keys": "d1:ai1e1:ai2ee",
+        "missing value": "d1:ae",
+        "unbalanced end": "e",
+        "trailing data": "i1ei2e",
+    }
+
+    for name, encoded := range tests {
+        err := bencode.ValidateBytes([]byte(encoded))
+        if err == nil {
+            t.Errorf("%s: expected an error validating %q", name, encoded)
+            continue
+        }
+        if !strings.Contains(err.Error(), "byte") {
+            t.Errorf("%s: error %q does not include an offset", name, err)
+        }
+    }
+}